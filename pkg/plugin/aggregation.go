@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const queryTypeAggregation = "aggregation"
+
+// method returns the OData aggregation method, accepting "avg" as short form of "average"
+func (a aggregate) method() (string, error) {
+	switch strings.ToLower(a.Method) {
+	case odata.AggregateSum, odata.AggregateMin, odata.AggregateMax, odata.AggregateCountDistinct,
+		odata.AggregateCount:
+		return strings.ToLower(a.Method), nil
+	case odata.AggregateAverage, "avg":
+		return odata.AggregateAverage, nil
+	default:
+		return "", fmt.Errorf("unsupported aggregation method: %s", a.Method)
+	}
+}
+
+// alias returns the name of the aggregated value in the result, e.g. "Amount_sum" if no alias is configured
+func (a aggregate) alias() string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	method, _ := a.method()
+	if method == odata.AggregateCount {
+		return "count"
+	}
+	return aliasName(a.Property.Name) + "_" + method
+}
+
+// resultType returns the Edm type of the aggregated value. Sums and averages are mapped to Edm.Double as services
+// return them as Edm.Decimal or Edm.Double regardless of the property type.
+func (a aggregate) resultType() string {
+	method, _ := a.method()
+	switch method {
+	case odata.AggregateCount, odata.AggregateCountDistinct:
+		return odata.EdmInt64
+	case odata.AggregateSum, odata.AggregateAverage:
+		return odata.EdmDouble
+	default:
+		return a.Property.Type
+	}
+}
+
+// complete returns the aggregation without the aggregates whose property has not been chosen yet in the editor. Only
+// $count aggregates need no property.
+func (agg *aggregation) complete() *aggregation {
+	complete := *agg
+	complete.Aggregates = slices.DeleteFunc(slices.Clone(agg.Aggregates), func(a aggregate) bool {
+		method, _ := a.method()
+		return a.Property.Name == "" && method != odata.AggregateCount
+	})
+	return &complete
+}
+
+// columns returns the properties of the aggregated result: the grouping properties followed by the aliases of the
+// aggregated values
+func (agg *aggregation) columns() []property {
+	var columns []property
+	columns = append(columns, agg.GroupBy...)
+	for _, a := range agg.Aggregates {
+		columns = append(columns, property{Name: a.alias(), Type: a.resultType()})
+	}
+	return columns
+}
+
+// mapApply builds the $apply transformations, e.g.
+// filter(Year ge 2020)/groupby((Country),aggregate(Amount with sum as Amount_sum))
+// Filter conditions are applied before grouping as $filter would be evaluated on the aggregated result. With a time
+// bucket, the date parts of the time property are computed and grouped by in addition.
+func mapApply(agg *aggregation, bucket *timeBucket, filter string, version string) (string, error) {
+	if odata.IsV2(version) {
+		return "", fmt.Errorf("aggregation requires an OData V4 service, the service uses version %s", version)
+	}
+	var aggregates []string
+	for _, a := range agg.Aggregates {
+		method, err := a.method()
+		if err != nil {
+			return "", err
+		}
+		if method == odata.AggregateCount {
+			aggregates = append(aggregates, fmt.Sprintf("$count as %s", a.alias()))
+		} else {
+			aggregates = append(aggregates, fmt.Sprintf("%s with %s as %s", a.Property.path(), method, a.alias()))
+		}
+	}
+
+	var transformations []string
+	if filter != "" {
+		transformations = append(transformations, fmt.Sprintf("filter(%s)", filter))
+	}
+	var groupBy []string
+	if bucket != nil {
+		var computes []string
+		for _, component := range bucket.Components {
+			computes = append(computes, fmt.Sprintf("%s(%s) as %s", component, bucket.Property.path(),
+				bucket.alias(component)))
+			groupBy = append(groupBy, bucket.alias(component))
+		}
+		transformations = append(transformations, fmt.Sprintf("compute(%s)", strings.Join(computes, ",")))
+	}
+	for _, p := range agg.GroupBy {
+		groupBy = append(groupBy, p.path())
+	}
+	aggregateTransformation := ""
+	if len(aggregates) > 0 {
+		aggregateTransformation = fmt.Sprintf("aggregate(%s)", strings.Join(aggregates, ","))
+	}
+	if len(groupBy) > 0 {
+		if aggregateTransformation != "" {
+			transformations = append(transformations,
+				fmt.Sprintf("groupby((%s),%s)", strings.Join(groupBy, ","), aggregateTransformation))
+		} else {
+			transformations = append(transformations, fmt.Sprintf("groupby((%s))", strings.Join(groupBy, ",")))
+		}
+	} else if aggregateTransformation != "" {
+		transformations = append(transformations, aggregateTransformation)
+	}
+	return strings.Join(transformations, "/"), nil
+}
+
+func (ds *ODataSource) queryAggregation(ctx context.Context, instance *ODataSourceInstance, query backend.DataQuery,
+	qm queryModel) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	if qm.Aggregation != nil {
+		qm.Aggregation = qm.Aggregation.complete()
+	}
+	// Prevent empty queries from being executed
+	if qm.Aggregation == nil || len(qm.Aggregation.GroupBy) == 0 && len(qm.Aggregation.Aggregates) == 0 {
+		return response
+	}
+
+	if qm.Aggregation.TimeBucket != "" {
+		return ds.queryTimeBuckets(ctx, instance, query, qm)
+	}
+
+	frame := newFrame(query.RefID)
+	columns := qm.Aggregation.columns()
+	for _, column := range columns {
+		frame.Fields = append(frame.Fields, data.NewField(column.Name, nil, odata.ToArray(column.Type)))
+	}
+
+	stats := newRequestStats()
+	resp, err := instance.client.Get(ctx, qm.EntitySet.Name, queryOptions{
+		FilterConditions: append(qm.FilterConditions, TimeRangeToFilter(query.TimeRange, qm.TimeProperty)...),
+		Filter:           qm.Filter,
+		Search:           qm.Search,
+		Aggregation:      qm.Aggregation,
+		OrderBy:          qm.OrderBy,
+		Top:              qm.Top,
+	})
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	if err := ds.readFrame(ctx, instance, resp, stats, frame, columns, -1); err != nil {
+		response.Error = err
+		return response
+	}
+
+	stats.apply(frame)
+	response.Frames = append(response.Frames, frame)
+	return response
+}
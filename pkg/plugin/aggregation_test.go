@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapApply(t *testing.T) {
+	tables := []struct {
+		name             string
+		aggregation      aggregation
+		bucket           *timeBucket
+		filterConditions []filterCondition
+		version          string
+		expected         string
+		expectedError    string
+	}{
+		{
+			name: "Aggregate only",
+			aggregation: anAggregation(
+				withAggregate(int32Prop, "sum", ""),
+				withAggregate(int32Prop, "avg", "")),
+			version:  odata.V4,
+			expected: "aggregate(int32 with sum as int32_sum,int32 with average as int32_average)",
+		},
+		{
+			name: "Group by with filter",
+			aggregation: anAggregation(
+				withGroupBy(stringProp, booleanProp),
+				withAggregate(int32Prop, "max", "Highest"),
+				withAggregate(int32Prop, "countdistinct", ""),
+				withAggregate(nil, "count", "")),
+			filterConditions: someFilterConditions(int32Eq5),
+			version:          odata.V4,
+			expected: "filter(int32 eq 5)/groupby((string,boolean),aggregate(int32 with max as Highest," +
+				"int32 with countdistinct as int32_countdistinct,$count as count))",
+		},
+		{
+			name:        "Group by only",
+			aggregation: anAggregation(withGroupBy(stringProp)),
+			version:     odata.V4,
+			expected:    "groupby((string))",
+		},
+		{
+			name:        "Time bucket",
+			aggregation: anAggregation(withGroupBy(stringProp), withAggregate(int32Prop, "sum", "")),
+			bucket:      &timeBucket{Property: aProperty(timeProp), Components: []string{"year", "month", "day"}},
+			version:     odata.V4,
+			expected: "compute(year(time) as time_year,month(time) as time_month,day(time) as time_day)/" +
+				"groupby((time_year,time_month,time_day,string),aggregate(int32 with sum as int32_sum))",
+		},
+		{
+			name: "Complex type properties",
+			aggregation: anAggregation(withGroupBy(cityProp),
+				withAggregate(func(p *property) { p.Name, p.Type = "Address.Floor", odata.EdmInt32 }, "max", "")),
+			version:  odata.V4,
+			expected: "groupby((Address/City),aggregate(Address/Floor with max as Address_Floor_max))",
+		},
+		{
+			name:          "Unsupported method",
+			aggregation:   anAggregation(withAggregate(int32Prop, "median", "")),
+			version:       odata.V4,
+			expectedError: "unsupported aggregation method: median",
+		},
+		{
+			name:          "V2 service",
+			aggregation:   anAggregation(withAggregate(int32Prop, "sum", "")),
+			version:       odata.V2,
+			expectedError: "aggregation requires an OData V4 service",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			filter, err := mapFilter(table.filterConditions, table.version)
+			assert.NoError(t, err)
+			apply, err := mapApply(&table.aggregation, table.bucket, filter, table.version)
+
+			// Assert
+			if table.expectedError != "" {
+				assert.ErrorContains(t, err, table.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, table.expected, apply)
+			}
+		})
+	}
+}
+
+func TestQueryAggregation(t *testing.T) {
+	// Arrange
+	var requestedApply string
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		requestedApply = r.URL.Query().Get(odata.Apply)
+		body, _ := json.Marshal(anOdataResponse(
+			withEntity(withProp("string", "A"), withProp("int32_sum", "12.5"), withProp("count", 3.0)),
+			withEntity(withProp("string", "B"), withProp("int32_sum", 7.0), withProp("count", 1.0))))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	})
+	is := ODataSourceInstance{client: client}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryType(queryTypeAggregation), withQueryModel(withTimeProperty("time"),
+		withAggregation(
+			withGroupBy(stringProp),
+			withAggregate(int32Prop, "sum", ""),
+			withAggregate(nil, "count", ""))))
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+	withoutRequestStats(resp.Frames)
+
+	// Assert
+	assert.NoError(t, resp.Error)
+	assert.Equal(t, "filter(time ge 2022-04-21T12:30:50Z and time le 2022-04-21T12:30:50Z)/"+
+		"groupby((string),aggregate(int32 with sum as int32_sum,$count as count))", requestedApply)
+	assert.Equal(t, aDataResponse(withBaseFrame("A",
+		withField("string", []*string{}),
+		withField("int32_sum", []*float64{}),
+		withField("count", []*int64{}),
+		withRow(withRowValue("A"), withRowValue(12.5), withRowValue(int64(3))),
+		withRow(withRowValue("B"), withRowValue(7.0), withRowValue(int64(1))),
+	)), resp)
+}
+
+func TestQueryAggregationEmpty(t *testing.T) {
+	// Arrange
+	client := clientMock{statusCode: 200}
+	is := ODataSourceInstance{client: &client}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryType(queryTypeAggregation), withQueryModel())
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+
+	// Assert
+	assert.Equal(t, backend.DataResponse{}, resp)
+}
+
+func TestQueryAggregationIncompleteAggregate(t *testing.T) {
+	// Arrange
+	var requestedApply string
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		requestedApply = r.URL.Query().Get(odata.Apply)
+		body, _ := json.Marshal(anOdataResponse(withEntity(withProp("string", "A"), withProp("count", 3.0))))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	})
+	is := ODataSourceInstance{client: client}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryType(queryTypeAggregation), withQueryModel(
+		withAggregation(
+			withGroupBy(stringProp),
+			withAggregate(nil, "sum", ""),
+			withAggregate(nil, "count", ""))))
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+	withoutRequestStats(resp.Frames)
+
+	// Assert
+	assert.NoError(t, resp.Error)
+	assert.Equal(t, "groupby((string),aggregate($count as count))", requestedApply)
+	assert.Equal(t, aDataResponse(withBaseFrame("A",
+		withField("string", []*string{}),
+		withField("count", []*int64{}),
+		withRow(withRowValue("A"), withRowValue(int64(3))),
+	)), resp)
+}
@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const queryTypeAnnotations = "annotations"
+
+// queryAnnotations reads events as annotation frame with the fields time, timeEnd, title, text and tags, which
+// Grafana maps to annotations. Tags are joined with commas. Events without start time are skipped, regions without end
+// time, e.g. open incidents, last until the end of the time range.
+func (ds *ODataSource) queryAnnotations(ctx context.Context, instance *ODataSourceInstance, query backend.DataQuery,
+	qm queryModel) backend.DataResponse {
+	response := backend.DataResponse{}
+	if qm.TimeProperty == nil {
+		response.Error = errors.New("annotations require a time property")
+		return response
+	}
+	a := qm.Annotation
+	if a == nil {
+		a = &annotation{}
+	}
+
+	properties := []property{*qm.TimeProperty}
+	filterConditions := append([]filterCondition{}, qm.FilterConditions...)
+	filter := qm.Filter
+	if a.TimeEndProperty != nil {
+		// Regions overlapping the time range: start before its end and end after its start or not at all
+		properties = append(properties, *a.TimeEndProperty)
+		filterConditions = append(filterConditions, TimeRangeToFilter(query.TimeRange, qm.TimeProperty)[1])
+		endsAfterStart := TimeRangeToFilter(query.TimeRange, a.TimeEndProperty)[0]
+		filter = &filterNode{Operator: filterAnd, Children: []filterNode{{Operator: filterOr, Children: []filterNode{
+			{Condition: &endsAfterStart},
+			{Condition: &filterCondition{Property: *a.TimeEndProperty, Operator: operatorIsNull}},
+		}}}}
+		if qm.Filter != nil {
+			filter.Children = append(filter.Children, *qm.Filter)
+		}
+	} else {
+		filterConditions = append(filterConditions, TimeRangeToFilter(query.TimeRange, qm.TimeProperty)...)
+	}
+	for _, p := range []*property{a.TitleProperty, a.TextProperty} {
+		if p != nil {
+			properties = append(properties, *p)
+		}
+	}
+	properties = append(properties, a.TagProperties...)
+	properties, err := ds.resolveSelectPaths(ctx, instance, qm.EntitySet.Name, uniqueProperties(properties))
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	stats := newRequestStats()
+	resp, err := instance.client.Get(ctx, qm.EntitySet.Name, queryOptions{
+		Properties:       properties,
+		FilterConditions: filterConditions,
+		Filter:           filter,
+		Search:           qm.Search,
+	})
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	frame := data.NewFrame(query.RefID, data.NewField("time", nil, []*time.Time{}))
+	if a.TimeEndProperty != nil {
+		frame.Fields = append(frame.Fields, data.NewField("timeEnd", nil, []*time.Time{}))
+	}
+	if a.TitleProperty != nil {
+		frame.Fields = append(frame.Fields, data.NewField("title", nil, []*string{}))
+	}
+	if a.TextProperty != nil {
+		frame.Fields = append(frame.Fields, data.NewField("text", nil, []*string{}))
+	}
+	if len(a.TagProperties) > 0 {
+		frame.Fields = append(frame.Fields, data.NewField("tags", nil, []*string{}))
+	}
+
+	notice, err := ds.readPages(ctx, instance, resp, stats, entityMaps(func(entity map[string]interface{}) {
+		start := timeValue(entity, *qm.TimeProperty)
+		if start == nil {
+			return
+		}
+		values := []interface{}{start}
+		if a.TimeEndProperty != nil {
+			end := timeValue(entity, *a.TimeEndProperty)
+			if end == nil {
+				end = &query.TimeRange.To
+			}
+			values = append(values, end)
+		}
+		if a.TitleProperty != nil {
+			values = append(values, stringValue(entity, *a.TitleProperty))
+		}
+		if a.TextProperty != nil {
+			values = append(values, stringValue(entity, *a.TextProperty))
+		}
+		if len(a.TagProperties) > 0 {
+			var tags []string
+			for _, p := range a.TagProperties {
+				if tag := stringValue(entity, p); tag != nil && *tag != "" {
+					tags = append(tags, *tag)
+				}
+			}
+			joined := strings.Join(tags, ",")
+			values = append(values, &joined)
+		}
+		frame.AppendRow(values...)
+	}))
+	if err != nil {
+		response.Error = err
+		return response
+	}
+	if notice != nil {
+		frame.AppendNotices(*notice)
+	}
+
+	stats.apply(frame)
+	response.Frames = append(response.Frames, frame)
+	return response
+}
+
+// timeValue returns the value of a date/time property as time, nil if it is null or not a valid time
+func timeValue(entity map[string]interface{}, p property) *time.Time {
+	value, ok := odata.LookupValue(entity, p.Name)
+	if !ok {
+		return nil
+	}
+	t, _ := odata.MapValue(value, p.Type).(*time.Time)
+	return t
+}
+
+// stringValue returns the value of a property of any type as text, nil if it is null
+func stringValue(entity map[string]interface{}, p property) *string {
+	value, ok := odata.LookupValue(entity, p.Name)
+	if !ok {
+		return nil
+	}
+	if text, ok := formatValue(odata.MapValue(value, p.Type)); ok {
+		return &text
+	}
+	return nil
+}
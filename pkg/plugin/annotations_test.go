@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryAnnotations(t *testing.T) {
+	start := time.Date(2022, 4, 21, 10, 0, 0, 0, time.UTC)
+	end := start.Add(30 * time.Minute)
+	to := aOneDayTimeRange().To
+	tables := []struct {
+		name           string
+		end            interface{}
+		queryModel     func(*backend.DataQuery)
+		expectedFilter string
+		expectedSelect string
+		expected       *data.Frame
+	}{
+		{
+			name: "Events",
+			end:  end.Format(time.RFC3339),
+			queryModel: withQueryModel(withTimeProperty("time"),
+				withAnnotation("", "title", "", "service", "stage")),
+			expectedFilter: "time ge 2022-04-21T12:30:50Z and time le 2022-04-21T12:30:50Z",
+			expectedSelect: "time,title,service,stage",
+			expected: data.NewFrame("A",
+				data.NewField("time", nil, []*time.Time{&start}),
+				data.NewField("title", nil, []*string{pointerTo("Deployment")}),
+				data.NewField("tags", nil, []*string{pointerTo("api,prod")})),
+		},
+		{
+			name: "Regions",
+			end:  end.Format(time.RFC3339),
+			queryModel: withQueryModel(withTimeProperty("time"),
+				withAnnotation("end", "", "text")),
+			expectedFilter: "time le 2022-04-21T12:30:50Z and (end ge 2022-04-21T12:30:50Z or end eq null)",
+			expectedSelect: "time,end,text",
+			expected: data.NewFrame("A",
+				data.NewField("time", nil, []*time.Time{&start}),
+				data.NewField("timeEnd", nil, []*time.Time{&end}),
+				data.NewField("text", nil, []*string{pointerTo("Outage")})),
+		},
+		{
+			name: "Open regions",
+			queryModel: withQueryModel(withTimeProperty("time"), withAnnotation("end", "", "text"), withFilter(
+				anOrGroup(aConditionNode(int32Eq5), aConditionNode(withFilterCondition(int32Prop, "eq", "6"))))),
+			expectedFilter: "time le 2022-04-21T12:30:50Z and " +
+				"((end ge 2022-04-21T12:30:50Z or end eq null) and (int32 eq 5 or int32 eq 6))",
+			expectedSelect: "time,end,text",
+			expected: data.NewFrame("A",
+				data.NewField("time", nil, []*time.Time{&start}),
+				data.NewField("timeEnd", nil, []*time.Time{&to}),
+				data.NewField("text", nil, []*string{pointerTo("Outage")})),
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			var requestedFilter, requestedSelect string
+			client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+				requestedFilter = r.URL.Query().Get(odata.Filter)
+				requestedSelect = r.URL.Query().Get(odata.Select)
+				body, _ := json.Marshal(anOdataResponse(
+					withEntity(withProp("time", start.Format(time.RFC3339)), withProp("end", table.end),
+						withProp("title", "Deployment"), withProp("text", "Outage"),
+						withProp("service", "api"), withProp("stage", "prod")),
+					withEntity(withProp("time", nil), withProp("title", "No time"))))
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(body)
+			})
+			is := ODataSourceInstance{client: client}
+			ds := ODataSource{&managerMock{}}
+			query := aDataQuery("A", withQueryType(queryTypeAnnotations), table.queryModel)
+
+			// Act
+			resp := ds.query(context.TODO(), &is, query)
+			withoutRequestStats(resp.Frames)
+
+			// Assert
+			assert.NoError(t, resp.Error)
+			assert.Equal(t, table.expectedFilter, requestedFilter)
+			assert.Equal(t, table.expectedSelect, requestedSelect)
+			assert.Equal(t, data.Frames{table.expected}, resp.Frames)
+		})
+	}
+}
+
+func TestQueryAnnotationsWithoutTimeProperty(t *testing.T) {
+	// Arrange
+	client := clientMock{statusCode: 200}
+	is := ODataSourceInstance{client: &client}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryType(queryTypeAnnotations), withQueryModel(withAnnotation("", "title", "")))
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+
+	// Assert
+	assert.ErrorContains(t, resp.Error, "annotations require a time property")
+}
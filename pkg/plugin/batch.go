@@ -0,0 +1,361 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// batch combines the first request of each query of a QueryData request into a single $batch request. It is sent
+// once every query either added its request or finished without one.
+type batch struct {
+	ctx     context.Context
+	client  *ODataClientImpl
+	version string
+	// maxResponseSize is the response size limit of a query in megabytes
+	maxResponseSize int
+	mu              sync.Mutex
+	pending         int
+	parts           []*batchPart
+}
+
+// batchPart is a request of the batch and, once the batch was sent, its response
+type batchPart struct {
+	req  *http.Request
+	done chan struct{}
+	resp *http.Response
+	err  error
+}
+
+// newBatch creates a batch for the given number of queries, whose responses may each be up to maxResponseSize
+// megabytes. It returns nil if the client cannot send batches.
+func newBatch(ctx context.Context, client ODataClient, queries int, maxResponseSize int) *batch {
+	impl, ok := client.(*ODataClientImpl)
+	if !ok {
+		return nil
+	}
+	return &batch{ctx: ctx, client: impl, version: impl.odataVersion(ctx), maxResponseSize: maxResponseSize,
+		pending: queries}
+}
+
+// add adds the request to the batch and sends the batch if it was the last one missing
+func (b *batch) add(req *http.Request) *batchPart {
+	part := &batchPart{req: req, done: make(chan struct{})}
+	b.mu.Lock()
+	b.parts = append(b.parts, part)
+	b.pending--
+	complete := b.pending == 0
+	b.mu.Unlock()
+	if complete {
+		b.send()
+	}
+	return part
+}
+
+// leave removes a query that finished without adding a request, and sends the batch if it was the last one missing
+func (b *batch) leave() {
+	b.mu.Lock()
+	b.pending--
+	complete := b.pending == 0
+	b.mu.Unlock()
+	if complete {
+		b.send()
+	}
+}
+
+func (b *batch) send() {
+	switch len(b.parts) {
+	case 0:
+		return
+	case 1:
+		// A batch of one request is no improvement over the request itself
+		part := b.parts[0]
+		part.resp, part.err = b.client.do(part.req)
+		close(part.done)
+		return
+	}
+	var err error
+	if odata.IsV401(b.version) {
+		err = b.sendJSON()
+	} else {
+		err = b.sendMultipart()
+	}
+	for i, part := range b.parts {
+		if part.resp == nil && part.err == nil {
+			part.err = err
+			if part.err == nil {
+				part.err = fmt.Errorf("batch response is missing the response of request %d", i+1)
+			}
+		}
+		close(part.done)
+	}
+}
+
+// relativeUrl returns the URL of the request relative to the service root, as expected in the batch
+func (b *batch) relativeUrl(req *http.Request) string {
+	base, err := url.Parse(b.client.baseUrl)
+	if err != nil {
+		return req.URL.String()
+	}
+	relative := strings.TrimPrefix(req.URL.EscapedPath(), strings.TrimSuffix(base.EscapedPath(), "/")+"/")
+	if req.URL.RawQuery != "" {
+		relative += "?" + req.URL.RawQuery
+	}
+	return relative
+}
+
+func (b *batch) post(body []byte, contentType string, accept string) (*http.Response, error) {
+	batchUrl, err := url.Parse(b.client.baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	batchUrl.Path = path.Join(batchUrl.Path, odata.Batch)
+	req, err := http.NewRequestWithContext(b.ctx, http.MethodPost, batchUrl.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating new request with context: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", accept)
+	log.DefaultLogger.Debug("Sending batch", "url", batchUrl.String(), "requests", len(b.parts))
+	resp, err := b.client.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, newResponseError("batch", resp)
+	}
+	return resp, nil
+}
+
+// limitedBody limits the batch response to the response size limit of each of its requests together. The responses
+// of the requests are limited again when they are read by their queries.
+func (b *batch) limitedBody(resp *http.Response) io.Reader {
+	limit := newResponseLimit(b.maxResponseSize)
+	limit.remaining *= int64(len(b.parts))
+	return &limitedBody{body: resp.Body, limit: limit}
+}
+
+// sendMultipart sends the batch as multipart/mixed document, one application/http part per request. The responses
+// are returned in the order of the requests.
+func (b *batch) sendMultipart() error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i, part := range b.parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		header.Set("Content-Transfer-Encoding", "binary")
+		header.Set("Content-ID", strconv.Itoa(i+1))
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(partWriter, "GET %s HTTP/1.1\r\nAccept: %s\r\n\r\n", b.relativeUrl(part.req),
+			part.req.Header.Get("Accept"))
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	resp, err := b.post(body.Bytes(), "multipart/mixed; boundary="+writer.Boundary(), "multipart/mixed")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return fmt.Errorf("unexpected batch response content type %q", resp.Header.Get("Content-Type"))
+	}
+	reader := multipart.NewReader(b.limitedBody(resp), params["boundary"])
+	for _, part := range b.parts {
+		responsePart, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading batch response: %w", err)
+		}
+		partResp, err := http.ReadResponse(bufio.NewReader(responsePart), part.req)
+		if err != nil {
+			part.err = fmt.Errorf("error reading batch response: %w", err)
+			continue
+		}
+		partBody, err := io.ReadAll(partResp.Body)
+		if err != nil {
+			part.err = fmt.Errorf("error reading batch response: %w", err)
+			continue
+		}
+		partResp.Body = io.NopCloser(bytes.NewReader(partBody))
+		part.resp = partResp
+	}
+	return nil
+}
+
+type jsonBatchRequest struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type jsonBatchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// sendJSON sends the batch as JSON document of V4.01. The responses are matched to the requests by their id.
+func (b *batch) sendJSON() error {
+	var payload struct {
+		Requests []jsonBatchRequest `json:"requests"`
+	}
+	for i, part := range b.parts {
+		payload.Requests = append(payload.Requests, jsonBatchRequest{
+			ID:      strconv.Itoa(i + 1),
+			Method:  "get",
+			URL:     b.relativeUrl(part.req),
+			Headers: map[string]string{"accept": part.req.Header.Get("Accept")},
+		})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.post(body, "application/json", "application/json")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var result struct {
+		Responses []jsonBatchResponse `json:"responses"`
+	}
+	if err := json.NewDecoder(b.limitedBody(resp)).Decode(&result); err != nil {
+		return fmt.Errorf("error reading batch response: %w", err)
+	}
+	for _, r := range result.Responses {
+		index, err := strconv.Atoi(r.ID)
+		if err != nil || index < 1 || index > len(b.parts) {
+			log.DefaultLogger.Warn("Ignoring batch response of unknown request", "id", r.ID)
+			continue
+		}
+		part := b.parts[index-1]
+		part.resp = newJSONBatchPartResponse(r, part.req)
+	}
+	return nil
+}
+
+// newJSONBatchPartResponse maps a response of a JSON batch to the response of its request. Bodies that are no JSON,
+// e.g. the text/plain result of $count, are embedded as JSON strings.
+func newJSONBatchPartResponse(r jsonBatchResponse, req *http.Request) *http.Response {
+	header := http.Header{}
+	for name, value := range r.Headers {
+		header.Set(name, value)
+	}
+	body := []byte(r.Body)
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte(`"`)) {
+		var text string
+		if err := json.Unmarshal(body, &text); err == nil {
+			body = []byte(text)
+		}
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode: r.Status,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// batchClient is the client of a single query in batch mode. Its first Get is sent as part of the batch, all other
+// requests, e.g. for next pages or fallbacks, are sent directly.
+type batchClient struct {
+	batch   *batch
+	mu      sync.Mutex
+	batched bool
+}
+
+func (b *batch) newClient() *batchClient {
+	return &batchClient{batch: b}
+}
+
+// done is called when the query finished, so that the batch does not wait for it any longer
+func (c *batchClient) done() {
+	if c.takeTurn() {
+		c.batch.leave()
+	}
+}
+
+// takeTurn reports whether the query did not yet add its request to the batch and marks it as added
+func (c *batchClient) takeTurn() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	first := !c.batched
+	c.batched = true
+	return first
+}
+
+func (c *batchClient) rememberVersion(version string) {
+	c.batch.client.rememberVersion(version)
+}
+
+func (c *batchClient) GetServiceRoot(ctx context.Context) (*http.Response, error) {
+	return c.batch.client.GetServiceRoot(ctx)
+}
+
+func (c *batchClient) GetMetadata(ctx context.Context, etag string) (*http.Response, error) {
+	return c.batch.client.GetMetadata(ctx, etag)
+}
+
+func (c *batchClient) Get(ctx context.Context, entitySet string, options queryOptions) (*http.Response, error) {
+	if !c.takeTurn() {
+		return c.batch.client.Get(ctx, entitySet, options)
+	}
+	req, err := c.batch.client.newGetRequest(ctx, entitySet, options)
+	if err != nil {
+		c.batch.leave()
+		return nil, err
+	}
+	part := c.batch.add(req)
+	select {
+	case <-part.done:
+		return part.resp, part.err
+	case <-ctx.Done():
+		go func() {
+			<-part.done
+			if part.resp != nil {
+				_ = part.resp.Body.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *batchClient) GetNextPage(ctx context.Context, nextLink string) (*http.Response, error) {
+	return c.batch.client.GetNextPage(ctx, nextLink)
+}
+
+func (c *batchClient) GetReference(ctx context.Context, uri string) (*http.Response, error) {
+	return c.batch.client.GetReference(ctx, uri)
+}
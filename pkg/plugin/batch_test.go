@@ -0,0 +1,255 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const batchErrorBody = `{"error":{"code":"InvalidFilter","message":"Property 'foo' does not exist"}}`
+
+// batchServer answers the requests of a batch with an entity, or with an error for requests filtering on foo
+type batchServer struct {
+	version string
+	status  int
+	// padding is the length of a string property added to the entities of the batch responses
+	padding  int
+	mu       sync.Mutex
+	batches  int
+	requests []string
+	direct   []string
+}
+
+func (s *batchServer) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(odata.HeaderODataVersion, s.version)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.URL.Path == "/":
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path != "/$batch":
+		s.direct = append(s.direct, r.URL.Path)
+		body, _ := json.Marshal(anOdataResponse(withDefaultEntity()))
+		_, _ = w.Write(body)
+	case s.status != 0:
+		w.WriteHeader(s.status)
+	case strings.HasPrefix(r.Header.Get("Content-Type"), "application/json"):
+		s.batches++
+		s.handleJSON(w, r)
+	default:
+		s.batches++
+		s.handleMultipart(w, r)
+	}
+}
+
+func (s *batchServer) answer(relativeUrl string) (int, string) {
+	s.requests = append(s.requests, relativeUrl)
+	decoded, _ := url.QueryUnescape(relativeUrl)
+	if strings.Contains(decoded, "foo") {
+		return http.StatusBadRequest, batchErrorBody
+	}
+	entity := withDefaultEntity()
+	if s.padding > 0 {
+		entity = withEntity(withProp("padding", strings.Repeat("x", s.padding)))
+	}
+	body, _ := json.Marshal(anOdataResponse(entity))
+	return http.StatusOK, string(body)
+}
+
+func (s *batchServer) handleMultipart(w http.ResponseWriter, r *http.Request) {
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	writer := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		// The request line contains the URL relative to the service root, which http.ReadRequest rejects
+		requestLine, err := textproto.NewReader(bufio.NewReader(part)).ReadLine()
+		fields := strings.Fields(requestLine)
+		if err != nil || len(fields) != 3 || fields[0] != http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		status, body := s.answer(fields[1])
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		partWriter, _ := writer.CreatePart(header)
+		_, _ = fmt.Fprintf(partWriter, "HTTP/1.1 %d %s\r\nContent-Type: application/json\r\n"+
+			"Content-Length: %d\r\n\r\n%s", status, http.StatusText(status), len(body), body)
+	}
+	_ = writer.Close()
+}
+
+func (s *batchServer) handleJSON(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Requests []jsonBatchRequest `json:"requests"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&payload)
+	var result struct {
+		Responses []jsonBatchResponse `json:"responses"`
+	}
+	// Responses may be returned in any order
+	for i := len(payload.Requests) - 1; i >= 0; i-- {
+		status, body := s.answer(payload.Requests[i].URL)
+		result.Responses = append(result.Responses, jsonBatchResponse{ID: payload.Requests[i].ID, Status: status,
+			Headers: map[string]string{"content-type": "application/json"}, Body: json.RawMessage(body)})
+	}
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func fooProp(p *property) {
+	p.Name = "foo"
+	p.Type = odata.EdmString
+}
+
+func TestQueryDataBatch(t *testing.T) {
+	tables := []struct {
+		name    string
+		version string
+	}{
+		{
+			name:    "Multipart",
+			version: "4.0",
+		},
+		{
+			name:    "Multipart V2",
+			version: "2.0",
+		},
+		{
+			name:    "JSON",
+			version: "4.01",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			server := &batchServer{version: table.version}
+			client := GetOC("*", server.handle)
+			im := managerMock{}
+			ds := ODataSource{&im}
+			is := ODataSourceInstance{client: client, settings: DatasourceSettings{BatchRequests: true}}
+			im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
+			req := aQueryDataRequest(
+				withDataQuery("A", withQueryModel(withTimeProperty("time"))),
+				withDataQuery("B", withQueryModel(withTimeProperty("time"),
+					withFilterConditions(withFilterCondition(fooProp, "eq", "x")))),
+				withDataQuery("C", withQueryModel(withTimeProperty("time"), withProperties(int32Prop))))
+
+			// Act
+			result, err := ds.QueryData(context.TODO(), &req)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, 1, server.batches)
+			if assert.Len(t, server.requests, 3) {
+				assert.True(t, strings.HasPrefix(server.requests[0], "Temperatures?"), server.requests[0])
+			}
+			assert.Empty(t, server.direct)
+			for _, refId := range []string{"A", "C"} {
+				if assert.NoError(t, result.Responses[refId].Error, refId) {
+					assert.Equal(t, 1, result.Responses[refId].Frames[0].Rows())
+					assert.Contains(t, result.Responses[refId].Frames[0].Meta.ExecutedQueryString, "/Temperatures?")
+				}
+			}
+			assert.EqualError(t, result.Responses["B"].Error, "get failed with status code 400: InvalidFilter: "+
+				"Property 'foo' does not exist")
+			assert.Equal(t, backend.StatusBadRequest, result.Responses["B"].Status)
+		})
+	}
+}
+
+func TestQueryDataBatchResponseSize(t *testing.T) {
+	for _, version := range []string{"4.0", "4.01"} {
+		t.Run(version, func(t *testing.T) {
+			// Arrange
+			server := &batchServer{version: version, padding: 3 << 19}
+			client := GetOC("*", server.handle)
+			im := managerMock{}
+			ds := ODataSource{&im}
+			is := ODataSourceInstance{client: client, settings: DatasourceSettings{BatchRequests: true,
+				MaxResponseSize: 1}}
+			im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
+			req := aQueryDataRequest(withDataQuery("A", withQueryModel(withTimeProperty("time"))),
+				withDataQuery("B", withQueryModel(withTimeProperty("time"))))
+
+			// Act
+			result, err := ds.QueryData(context.TODO(), &req)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, 1, server.batches)
+			batchErrors := 0
+			for _, refId := range []string{"A", "B"} {
+				require.ErrorContains(t, result.Responses[refId].Error, "response exceeds the maximum size of 1 MB")
+				if strings.HasPrefix(result.Responses[refId].Error.Error(), "error reading batch response") {
+					batchErrors++
+				}
+			}
+			// The batch response is read up to the limits of both queries together
+			assert.NotZero(t, batchErrors)
+		})
+	}
+}
+
+func TestQueryDataBatchFailed(t *testing.T) {
+	// Arrange
+	server := &batchServer{version: "4.0", status: http.StatusNotImplemented}
+	client := GetOC("*", server.handle)
+	im := managerMock{}
+	ds := ODataSource{&im}
+	is := ODataSourceInstance{client: client, settings: DatasourceSettings{BatchRequests: true}}
+	im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
+	req := aQueryDataRequest(withDataQuery("A", withQueryModel(withTimeProperty("time"))),
+		withDataQuery("B", withQueryModel(withTimeProperty("time"))))
+
+	// Act
+	result, err := ds.QueryData(context.TODO(), &req)
+
+	// Assert
+	require.NoError(t, err)
+	for _, refId := range []string{"A", "B"} {
+		assert.EqualError(t, result.Responses[refId].Error, "batch failed with status code 501")
+		assert.Equal(t, backend.ErrorSourceDownstream, result.Responses[refId].ErrorSource)
+	}
+}
+
+func TestQueryDataBatchSingleRequest(t *testing.T) {
+	// Arrange
+	server := &batchServer{version: "4.0"}
+	client := GetOC("*", server.handle)
+	im := managerMock{}
+	ds := ODataSource{&im}
+	is := ODataSourceInstance{client: client, settings: DatasourceSettings{BatchRequests: true}}
+	im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
+	req := aQueryDataRequest(withDataQuery("A", withQueryModel(withTimeProperty("time"))),
+		withDataQuery("B", withQueryModel()))
+
+	// Act
+	result, err := ds.QueryData(context.TODO(), &req)
+
+	// Assert
+	require.NoError(t, err)
+	assert.NoError(t, result.Responses["A"].Error)
+	assert.Equal(t, 0, server.batches)
+	assert.Equal(t, []string{"/Temperatures"}, server.direct)
+}
@@ -3,10 +3,14 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
@@ -14,67 +18,297 @@ import (
 
 type ODataClient interface {
 	GetServiceRoot(ctx context.Context) (*http.Response, error)
-	GetMetadata(ctx context.Context) (*http.Response, error)
-	Get(ctx context.Context, entitySet string, properties []property,
-		filterConditions []filterCondition) (*http.Response, error)
+	GetMetadata(ctx context.Context, etag string) (*http.Response, error)
+	Get(ctx context.Context, entitySet string, options queryOptions) (*http.Response, error)
+	GetNextPage(ctx context.Context, nextLink string) (*http.Response, error)
+	GetReference(ctx context.Context, uri string) (*http.Response, error)
+}
+
+// queryOptions are the system query options of a request to an entity set
+type queryOptions struct {
+	Properties       []property
+	FilterConditions []filterCondition
+	Filter           *filterNode
+	Search           string
+	Aggregation      *aggregation
+	TimeBucket       *timeBucket
+	OrderBy          []orderBy
+	Top              int64
+	// CountOnly requests the number of matching entities as plain text via the $count path segment
+	CountOnly bool
+	// InlineCount requests the number of matching entities with an empty page of entities
+	InlineCount bool
 }
 
 type ODataClientImpl struct {
 	httpClient       *http.Client
 	baseUrl          string
 	urlSpaceEncoding string
+	versionMu        sync.Mutex
+	version          string
+	// requests limits the requests in flight, from sending the request until the response body is closed. It is
+	// unlimited if nil.
+	requests chan struct{}
 }
 
 func (client *ODataClientImpl) get(ctx context.Context, url string, mimeType string) (*http.Response, error) {
+	req, err := newRequest(ctx, url, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	return client.do(req)
+}
+
+func newRequest(ctx context.Context, url string, mimeType string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating new request with context: %w", err)
 	}
 	req.Header.Set("Accept", mimeType)
-	return client.httpClient.Do(req)
+	return req, nil
+}
+
+func (client *ODataClientImpl) do(req *http.Request) (*http.Response, error) {
+	if client.requests != nil {
+		if err := acquire(req.Context(), client.requests); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.httpClient.Do(req)
+	if client.requests != nil {
+		if err != nil {
+			<-client.requests
+		} else {
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-client.requests }}
+		}
+	}
+	if err == nil {
+		client.rememberVersion(odata.VersionFromHeader(resp.Header))
+	}
+	return resp, err
+}
+
+// releasingBody releases the request slot of a response once its body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func (client *ODataClientImpl) rememberVersion(version string) {
+	if version == "" {
+		return
+	}
+	client.versionMu.Lock()
+	defer client.versionMu.Unlock()
+	client.version = version
+}
+
+// odataVersion returns the OData version of the service. It is taken from the headers of previous responses or the
+// metadata document or, if there were none yet, requested from the service root. Services that do not announce a
+// version are treated as V4, as are services whose service root cannot be requested.
+func (client *ODataClientImpl) odataVersion(ctx context.Context) string {
+	client.versionMu.Lock()
+	version := client.version
+	client.versionMu.Unlock()
+	if version != "" {
+		return version
+	}
+	resp, err := client.GetServiceRoot(ctx)
+	if err != nil {
+		log.DefaultLogger.Warn("OData version detection failed", "error", err)
+		client.rememberVersion(odata.V4)
+		return odata.V4
+	}
+	_ = resp.Body.Close()
+	if version = odata.VersionFromHeader(resp.Header); version == "" {
+		version = odata.V4
+		client.rememberVersion(version)
+	}
+	return version
 }
 
 func (client *ODataClientImpl) GetServiceRoot(ctx context.Context) (*http.Response, error) {
 	return client.get(ctx, client.baseUrl, "application/json")
 }
 
-func (client *ODataClientImpl) GetMetadata(ctx context.Context) (*http.Response, error) {
+// GetMetadata requests the metadata document. If an ETag is given, the service may answer 304 Not Modified if the
+// document did not change since.
+func (client *ODataClientImpl) GetMetadata(ctx context.Context, etag string) (*http.Response, error) {
 	requestUrl, err := url.Parse(client.baseUrl)
 	if err != nil {
 		return nil, err
 	}
 	requestUrl.Path = path.Join(requestUrl.Path, odata.Metadata)
+	req, err := newRequest(ctx, requestUrl.String(), "application/xml")
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	return client.do(req)
+}
+
+// GetReference requests a metadata document referenced via edmx:Reference. Relative URIs are resolved against the
+// service root like next links, documents on other hosts are not requested.
+func (client *ODataClientImpl) GetReference(ctx context.Context, uri string) (*http.Response, error) {
+	requestUrl, err := resolveNextLink(client.baseUrl, uri)
+	if err != nil {
+		return nil, err
+	}
 	return client.get(ctx, requestUrl.String(), "application/xml")
 }
 
-func (client *ODataClientImpl) Get(ctx context.Context, entitySet string, properties []property, filterConditions []filterCondition) (*http.Response, error) {
-	requestUrl, err := buildQueryUrl(client.baseUrl, entitySet, properties,
-		filterConditions, client.urlSpaceEncoding)
+func (client *ODataClientImpl) Get(ctx context.Context, entitySet string, options queryOptions) (*http.Response, error) {
+	req, err := client.newGetRequest(ctx, entitySet, options)
+	if err != nil {
+		return nil, err
+	}
+	return client.do(req)
+}
+
+// newGetRequest creates the request sent by Get
+func (client *ODataClientImpl) newGetRequest(ctx context.Context, entitySet string,
+	options queryOptions) (*http.Request, error) {
+	requestUrl, err := buildQueryUrl(client.baseUrl, entitySet, options, client.urlSpaceEncoding,
+		client.odataVersion(ctx))
 	if err != nil {
 		return nil, err
 	}
 	urlString := requestUrl.String()
 	log.DefaultLogger.Debug("Constructed request url", "url", urlString)
+	if options.CountOnly {
+		return newRequest(ctx, urlString, "text/plain")
+	}
+	return newRequest(ctx, urlString, "application/json")
+}
+
+func (client *ODataClientImpl) GetNextPage(ctx context.Context, nextLink string) (*http.Response, error) {
+	requestUrl, err := resolveNextLink(client.baseUrl, nextLink)
+	if err != nil {
+		return nil, err
+	}
+	urlString := requestUrl.String()
+	log.DefaultLogger.Debug("Following next link", "url", urlString)
 	return client.get(ctx, urlString, "application/json")
 }
 
-func buildQueryUrl(baseUrl string, entitySet string, properties []property, filterConditions []filterCondition, urlSpaceEncoding string) (*url.URL, error) {
+// resolveNextLink resolves a (possibly relative) @odata.nextLink against the service root. The service root is
+// treated as a directory, so "Temperatures?$skiptoken=1" resolves below it and not next to it. Links to another
+// scheme or host are rejected, as they would receive the credentials of the data source.
+func resolveNextLink(baseUrl string, nextLink string) (*url.URL, error) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	link, err := url.Parse(nextLink)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing next link: %w", err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	resolved := base.ResolveReference(link)
+	if !strings.EqualFold(resolved.Scheme, base.Scheme) || !strings.EqualFold(resolved.Hostname(), base.Hostname()) ||
+		effectivePort(resolved) != effectivePort(base) {
+		return nil, fmt.Errorf("link %s is not hosted by the service", nextLink)
+	}
+	return resolved, nil
+}
+
+// effectivePort returns the port of the URL, the default port of its scheme if none is given
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+func buildQueryUrl(baseUrl string, entitySet string, options queryOptions, urlSpaceEncoding string,
+	version string) (*url.URL, error) {
 	requestUrl, err := url.Parse(baseUrl)
 	if err != nil {
 		return nil, err
 	}
 	requestUrl.Path = path.Join(requestUrl.Path, entitySet)
+	if options.CountOnly {
+		requestUrl.Path = path.Join(requestUrl.Path, odata.Count)
+	}
 	params, err := url.ParseQuery(requestUrl.RawQuery)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing query: %w", err)
 	}
-	filterParam := mapFilter(filterConditions)
-	if len(filterParam) > 0 {
-		params.Add(odata.Filter, filterParam)
+	if err := validateSearch(options.Search); err != nil {
+		return nil, err
 	}
-	selectParam := mapSelect(properties)
-	if len(selectParam) > 0 {
-		params.Add(odata.Select, selectParam)
+	if options.Aggregation != nil {
+		filter, err := combineFilters(options.FilterConditions, options.Filter, version)
+		if err != nil {
+			return nil, err
+		}
+		applyParam, err := mapApply(options.Aggregation, options.TimeBucket, filter, version)
+		if err != nil {
+			return nil, err
+		}
+		if options.Search != "" {
+			// Search before grouping like the filter conditions
+			applyParam = strings.TrimSuffix(fmt.Sprintf("search(%s)/%s", options.Search, applyParam), "/")
+		}
+		if len(applyParam) > 0 {
+			params.Add(odata.Apply, applyParam)
+		}
+	} else {
+		filterParam, err := combineFilters(options.FilterConditions, options.Filter, version)
+		if err != nil {
+			return nil, err
+		}
+		if len(filterParam) > 0 {
+			params.Add(odata.Filter, filterParam)
+		}
+		if options.Search != "" {
+			params.Add(searchParameter(version), options.Search)
+		}
+		if options.InlineCount {
+			if odata.IsV2(version) {
+				params.Add(odata.InlineCount, "allpages")
+			} else {
+				params.Add(odata.Count, "true")
+			}
+			params.Add(odata.Top, "0")
+		}
+		selectParam, expandParam := mapSelectExpand(options.Properties, version)
+		if len(selectParam) > 0 {
+			params.Add(odata.Select, selectParam)
+		}
+		if len(expandParam) > 0 {
+			params.Add(odata.Expand, expandParam)
+		}
+	}
+	orderByParam, err := mapOrderBy(options.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	if len(orderByParam) > 0 {
+		params.Add(odata.OrderBy, orderByParam)
+	}
+	if options.Top < 0 {
+		return nil, fmt.Errorf("invalid top value: %d", options.Top)
+	}
+	if options.Top > 0 {
+		params.Add(odata.Top, strconv.FormatInt(options.Top, 10))
 	}
 	encodedUrl := params.Encode()
 	if urlSpaceEncoding == "%20" {
@@ -84,28 +318,131 @@ func buildQueryUrl(baseUrl string, entitySet string, properties []property, filt
 	return requestUrl, nil
 }
 
-func mapSelect(properties []property) string {
-	var result []string
-	if len(properties) > 0 {
-		for _, selectProp := range properties {
-			result = append(result, selectProp.Name)
+// validateSearch rejects search expressions with unbalanced quotes or parentheses, which services would only report
+// as a general syntax error. Quotes within phrases are escaped with a backslash.
+func validateSearch(search string) error {
+	depth := 0
+	inPhrase := false
+	for i := 0; i < len(search); i++ {
+		switch c := search[i]; {
+		case inPhrase && c == '\\':
+			i++
+		case c == '"':
+			inPhrase = !inPhrase
+		case !inPhrase && c == '(':
+			depth++
+		case !inPhrase && c == ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("invalid search expression %q: unbalanced parentheses", search)
+			}
 		}
 	}
-	return strings.Join(result[:], ",")
+	if inPhrase {
+		return fmt.Errorf("invalid search expression %q: unterminated phrase", search)
+	}
+	if depth != 0 {
+		return fmt.Errorf("invalid search expression %q: unbalanced parentheses", search)
+	}
+	return nil
 }
 
-func mapFilter(filterConditions []filterCondition) string {
-	var filter = ""
-	for index, element := range filterConditions {
-		if element.Property.Type == odata.EdmString {
-			filter += fmt.Sprintf("%s %s '%s'", element.Property.Name, element.Operator, element.Value)
-		} else {
-			filter += fmt.Sprintf("%s %s %s", element.Property.Name, element.Operator, element.Value)
+// searchParameter returns the name of the search query option. V2 has no $search, services like SAP Gateway accept
+// the custom query option "search" instead.
+func searchParameter(version string) string {
+	if odata.IsV2(version) {
+		return odata.SearchV2
+	}
+	return odata.Search
+}
+
+// mapOrderBy serializes the sort order, e.g. "Revenue desc,Name". Items without a property, which the editor adds
+// before one is chosen, are skipped.
+func mapOrderBy(orderBy []orderBy) (string, error) {
+	var items []string
+	for _, o := range orderBy {
+		if o.Property.Name == "" {
+			continue
 		}
-		if index < (len(filterConditions) - 1) {
-			filter += " and "
+		switch direction := strings.ToLower(o.Direction); direction {
+		case "", "asc":
+			items = append(items, o.Property.path())
+		case "desc":
+			items = append(items, o.Property.path()+" "+direction)
+		default:
+			return "", fmt.Errorf("unsupported order direction: %s", o.Direction)
 		}
 	}
+	return strings.Join(items, ","), nil
+}
+
+// expandNode collects the selected properties of an entity and the navigation properties to expand from it
+type expandNode struct {
+	selects []string
+	expands []string
+	nodes   map[string]*expandNode
+}
 
-	return filter
+func newExpandNode() *expandNode {
+	return &expandNode{nodes: make(map[string]*expandNode)}
+}
+
+func (node *expandNode) add(path []string) {
+	if len(path) == 1 {
+		node.selects = append(node.selects, strings.ReplaceAll(path[0], ".", "/"))
+		return
+	}
+	child, ok := node.nodes[path[0]]
+	if !ok {
+		child = newExpandNode()
+		node.nodes[path[0]] = child
+		node.expands = append(node.expands, path[0])
+	}
+	child.add(path[1:])
+}
+
+// expandOption renders the V4 $expand value with nested $select and $expand options,
+// e.g. Customer($select=Name;$expand=Country($select=Code))
+func (node *expandNode) expandOption() string {
+	var result []string
+	for _, name := range node.expands {
+		child := node.nodes[name]
+		var options []string
+		if len(child.selects) > 0 {
+			options = append(options, odata.Select+"="+strings.Join(child.selects, ","))
+		}
+		if len(child.expands) > 0 {
+			options = append(options, odata.Expand+"="+child.expandOption())
+		}
+		if len(options) > 0 {
+			name += "(" + strings.Join(options, ";") + ")"
+		}
+		result = append(result, name)
+	}
+	return strings.Join(result, ",")
+}
+
+// mapSelectExpand maps the selected properties to $select and $expand. Properties of related entities are given as
+// path, e.g. "Customer/Name". V4 services get nested query options, V2 services expect the navigation paths in
+// $expand and the full property paths in $select. Properties of complex types are selected by path on V4, e.g.
+// "Address/City", V2 services only select complex properties as a whole.
+func mapSelectExpand(properties []property, version string) (string, string) {
+	if odata.IsV2(version) {
+		var selects, expands []string
+		for _, selectProp := range properties {
+			name, _, _ := strings.Cut(selectProp.Name, ".")
+			if !slices.Contains(selects, name) {
+				selects = append(selects, name)
+			}
+			if i := strings.LastIndex(selectProp.Name, "/"); i > 0 && !slices.Contains(expands, selectProp.Name[:i]) {
+				expands = append(expands, selectProp.Name[:i])
+			}
+		}
+		return strings.Join(selects, ","), strings.Join(expands, ",")
+	}
+	root := newExpandNode()
+	for _, selectProp := range properties {
+		root.add(strings.Split(selectProp.Name, "/"))
+	}
+	return strings.Join(root.selects, ","), root.expandOption()
 }
@@ -15,6 +15,7 @@ func TestMapFilter(t *testing.T) {
 	tables := []struct {
 		name             string
 		filterConditions []filterCondition
+		version          string
 		expected         string
 	}{
 		{
@@ -47,14 +48,44 @@ func TestMapFilter(t *testing.T) {
 			filterConditions: someFilterConditions(withFilterCondition(stringProp, "eq", "")),
 			expected:         "string eq ''",
 		},
+		{
+			name: "V2 DateTime time filter",
+			filterConditions: someFilterConditions(
+				withFilterCondition(dateTimeProp, "ge", aOneDayTimeRange().From.Format(time.RFC3339)),
+				withFilterCondition(dateTimeProp, "le", aOneDayTimeRange().To.Format(time.RFC3339))),
+			version:  odata.V2,
+			expected: "datetime ge datetime'2022-04-21T12:30:50' and datetime le datetime'2022-04-21T12:30:50'",
+		},
+		{
+			name: "V2 DateTimeOffset time filter",
+			filterConditions: someFilterConditions(
+				withFilterCondition(timeProp, "ge", aOneDayTimeRange().From.Format(time.RFC3339))),
+			version:  odata.V2,
+			expected: "time ge datetimeoffset'2022-04-21T12:30:50Z'",
+		},
+		{
+			name: "V4 Guid filter",
+			filterConditions: someFilterConditions(
+				withFilterCondition(guidProp, "eq", "01234567-89ab-cdef-0123-456789abcdef")),
+			version:  odata.V4,
+			expected: "guid eq 01234567-89ab-cdef-0123-456789abcdef",
+		},
+		{
+			name: "V2 Guid filter",
+			filterConditions: someFilterConditions(
+				withFilterCondition(guidProp, "eq", "01234567-89ab-cdef-0123-456789abcdef")),
+			version:  odata.V2,
+			expected: "guid eq guid'01234567-89ab-cdef-0123-456789abcdef'",
+		},
 	}
 
 	for _, table := range tables {
 		t.Run(table.name, func(t *testing.T) {
 			// Act
-			var filterString = mapFilter(table.filterConditions)
+			filterString, err := mapFilter(table.filterConditions, table.version)
 
 			// Assert
+			assert.NoError(t, err)
 			assert.Equal(t, table.expected, filterString)
 		})
 	}
@@ -69,7 +100,13 @@ func TestBuildQueryUrl(t *testing.T) {
 		timeProperty     string
 		timeRange        []filterCondition
 		filterConditions []filterCondition
+		filter           *filterNode
+		orderBy          []orderBy
+		top              int64
+		search           string
+		aggregation      *aggregation
 		expected         string
+		expectedError    string
 	}{
 		{
 			name:       "Success",
@@ -82,20 +119,183 @@ func TestBuildQueryUrl(t *testing.T) {
 				withFilterCondition(stringProp, "eq", "")),
 			expected: "http://localhost:5000/Temperatures?%24filter=time+ge+2022-04-21T12%3A30%3A50Z+and+time+le+2022-04-21T12%3A30%3A50Z+and+string+eq+%27%27&%24select=int32%2Ctime",
 		},
+		{
+			name:       "Type-cast segment",
+			baseUrl:    "http://localhost:5000/odata",
+			entitySet:  "Orders/NS.SpecialOrder",
+			properties: []property{aProperty(int32Prop)},
+			expected:   "http://localhost:5000/odata/Orders/NS.SpecialOrder?%24select=int32",
+		},
+		{
+			name:       "Filter tree",
+			baseUrl:    "http://localhost:5000",
+			entitySet:  "Temperatures",
+			properties: []property{aProperty(int32Prop)},
+			filterConditions: someFilterConditions(
+				withFilterCondition(timeProp, "ge", aOneDayTimeRange().From.Format(time.RFC3339))),
+			filter:   anOrGroup(aConditionNode(int32Eq5), aConditionNode(withFilterCondition(stringProp, "eq", ""))),
+			expected: "http://localhost:5000/Temperatures?%24filter=time+ge+2022-04-21T12%3A30%3A50Z+and+%28int32+eq+5+or+string+eq+%27%27%29&%24select=int32",
+		},
+		{
+			name:       "Order by and top",
+			baseUrl:    "http://localhost:5000",
+			entitySet:  "Temperatures",
+			properties: []property{aProperty(int32Prop), aProperty(stringProp)},
+			orderBy: []orderBy{
+				{Property: aProperty(int32Prop), Direction: "desc"},
+				{Property: aProperty(stringProp), Direction: "asc"}},
+			top:      10,
+			expected: "http://localhost:5000/Temperatures?%24orderby=int32+desc%2Cstring&%24select=int32%2Cstring&%24top=10",
+		},
+		{
+			name:       "Order by without property",
+			baseUrl:    "http://localhost:5000",
+			entitySet:  "Temperatures",
+			properties: []property{aProperty(int32Prop)},
+			orderBy:    []orderBy{{Direction: "desc"}, {Property: aProperty(int32Prop)}},
+			expected:   "http://localhost:5000/Temperatures?%24orderby=int32&%24select=int32",
+		},
+		{
+			name:          "Invalid order direction",
+			baseUrl:       "http://localhost:5000",
+			entitySet:     "Temperatures",
+			orderBy:       []orderBy{{Property: aProperty(int32Prop), Direction: "up"}},
+			expectedError: "unsupported order direction: up",
+		},
+		{
+			name:             "Search",
+			baseUrl:          "http://localhost:5000",
+			entitySet:        "Temperatures",
+			properties:       []property{aProperty(int32Prop)},
+			filterConditions: someFilterConditions(int32Eq5),
+			search:           `"dark green" OR blue`,
+			expected:         "http://localhost:5000/Temperatures?%24filter=int32+eq+5&%24search=%22dark+green%22+OR+blue&%24select=int32",
+		},
+		{
+			name:        "Search with aggregation",
+			baseUrl:     "http://localhost:5000",
+			entitySet:   "Temperatures",
+			search:      "blue",
+			aggregation: &aggregation{GroupBy: []property{aProperty(stringProp)}},
+			expected:    "http://localhost:5000/Temperatures?%24apply=search%28blue%29%2Fgroupby%28%28string%29%29",
+		},
+		{
+			name:          "Unterminated search phrase",
+			baseUrl:       "http://localhost:5000",
+			entitySet:     "Temperatures",
+			search:        `"dark green`,
+			expectedError: "unterminated phrase",
+		},
+		{
+			name:          "Unbalanced search parentheses",
+			baseUrl:       "http://localhost:5000",
+			entitySet:     "Temperatures",
+			search:        "(blue OR green",
+			expectedError: "unbalanced parentheses",
+		},
 	}
 
 	for _, table := range tables {
 		t.Run(table.name, func(t *testing.T) {
 			// Act
-			var builtUrl, err = buildQueryUrl(table.baseUrl, table.entitySet, table.properties, table.filterConditions, "+")
+			var builtUrl, err = buildQueryUrl(table.baseUrl, table.entitySet, queryOptions{
+				Properties:       table.properties,
+				FilterConditions: table.filterConditions,
+				Filter:           table.filter,
+				OrderBy:          table.orderBy,
+				Top:              table.top,
+				Search:           table.search,
+				Aggregation:      table.aggregation,
+			}, "+", odata.V4)
 
 			// Assert
+			if table.expectedError != "" {
+				assert.ErrorContains(t, err, table.expectedError)
+				return
+			}
 			assert.NoError(t, err)
 			assert.Equal(t, table.expected, builtUrl.String())
 		})
 	}
 }
 
+func TestBuildQueryUrlSearchV2(t *testing.T) {
+	// Act
+	builtUrl, err := buildQueryUrl("http://localhost:5000", "Products", queryOptions{Search: "blue"}, "+", odata.V2)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:5000/Products?search=blue", builtUrl.String())
+}
+
+func TestMapSelectExpand(t *testing.T) {
+	tables := []struct {
+		name           string
+		properties     []string
+		version        string
+		expectedSelect string
+		expectedExpand string
+	}{
+		{
+			name:           "Properties only",
+			properties:     []string{"int32", "time"},
+			version:        odata.V4,
+			expectedSelect: "int32,time",
+		},
+		{
+			name:           "V4 expand",
+			properties:     []string{"int32", "Customer/Name", "Customer/City", "Product/Name"},
+			version:        odata.V4,
+			expectedSelect: "int32",
+			expectedExpand: "Customer($select=Name,City),Product($select=Name)",
+		},
+		{
+			name:           "V4 nested expand",
+			properties:     []string{"Customer/Name", "Customer/Country/Code"},
+			version:        odata.V4,
+			expectedExpand: "Customer($select=Name;$expand=Country($select=Code))",
+		},
+		{
+			name:           "V2 expand",
+			properties:     []string{"int32", "Customer/Name", "Customer/Country/Code"},
+			version:        odata.V2,
+			expectedSelect: "int32,Customer/Name,Customer/Country/Code",
+			expectedExpand: "Customer,Customer/Country",
+		},
+		{
+			name:           "V4 complex type",
+			properties:     []string{"Address.City", "Customer/Address.Location.Latitude"},
+			version:        odata.V4,
+			expectedSelect: "Address/City",
+			expectedExpand: "Customer($select=Address/Location/Latitude)",
+		},
+		{
+			name:           "V2 complex type",
+			properties:     []string{"Address.City", "Address.Street", "Customer/Address.City"},
+			version:        odata.V2,
+			expectedSelect: "Address,Customer/Address",
+			expectedExpand: "Customer",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			var properties []property
+			for _, name := range table.properties {
+				properties = append(properties, property{Name: name, Type: odata.EdmString})
+			}
+
+			// Act
+			selectParam, expandParam := mapSelectExpand(properties, table.version)
+
+			// Assert
+			assert.Equal(t, table.expectedSelect, selectParam)
+			assert.Equal(t, table.expectedExpand, expandParam)
+		})
+	}
+}
+
 func TestGetEntities(t *testing.T) {
 	tables := []struct {
 		name             string
@@ -133,7 +333,10 @@ func TestGetEntities(t *testing.T) {
 			client := GetOC("*", table.handlerCallback)
 
 			// Act
-			resp, err := client.Get(context.TODO(), "Temperatures", []property{aProperty(int32Prop)}, someFilterConditions(int32Eq5))
+			resp, err := client.Get(context.TODO(), "Temperatures", queryOptions{
+				Properties:       []property{aProperty(int32Prop)},
+				FilterConditions: someFilterConditions(int32Eq5),
+			})
 
 			// Assert
 			if table.expectedError == nil {
@@ -147,6 +350,164 @@ func TestGetEntities(t *testing.T) {
 	}
 }
 
+func TestResolveNextLink(t *testing.T) {
+	tables := []struct {
+		name     string
+		baseUrl  string
+		nextLink string
+		expected string
+	}{
+		{
+			name:     "Absolute link",
+			baseUrl:  "http://localhost:5000/odata",
+			nextLink: "http://localhost:5000/odata/Temperatures?$skiptoken=10",
+			expected: "http://localhost:5000/odata/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Relative link",
+			baseUrl:  "http://localhost:5000/odata",
+			nextLink: "Temperatures?$skiptoken=10",
+			expected: "http://localhost:5000/odata/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Relative link, base url with trailing slash",
+			baseUrl:  "http://localhost:5000/odata/",
+			nextLink: "Temperatures?$skiptoken=10",
+			expected: "http://localhost:5000/odata/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Absolute path",
+			baseUrl:  "http://localhost:5000/odata",
+			nextLink: "/other/Temperatures?$skiptoken=10",
+			expected: "http://localhost:5000/other/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Default port given",
+			baseUrl:  "https://svc.example.com/odata",
+			nextLink: "https://svc.example.com:443/odata/Temperatures?$skiptoken=10",
+			expected: "https://svc.example.com:443/odata/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Default port omitted",
+			baseUrl:  "http://SVC.example.com:80/odata",
+			nextLink: "http://svc.example.com/odata/Temperatures?$skiptoken=10",
+			expected: "http://svc.example.com/odata/Temperatures?$skiptoken=10",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			resolved, err := resolveNextLink(table.baseUrl, table.nextLink)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, table.expected, resolved.String())
+		})
+	}
+}
+
+func TestResolveNextLinkForeignHost(t *testing.T) {
+	tables := []struct {
+		name     string
+		nextLink string
+	}{
+		{
+			name:     "Other host",
+			nextLink: "http://attacker.example.com/odata/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Other port",
+			nextLink: "http://localhost:6000/odata/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Other scheme",
+			nextLink: "https://localhost:5000/odata/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Default port instead of given port",
+			nextLink: "http://localhost/odata/Temperatures?$skiptoken=10",
+		},
+		{
+			name:     "Protocol-relative link",
+			nextLink: "//attacker.example.com/Temperatures",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			_, err := resolveNextLink("http://localhost:5000/odata", table.nextLink)
+
+			// Assert
+			assert.ErrorContains(t, err, "is not hosted by the service")
+		})
+	}
+}
+
+func TestRequestLimit(t *testing.T) {
+	// Arrange
+	GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	client := &ODataClientImpl{httpClient: oc.httpClient, baseUrl: oc.baseUrl, requests: make(chan struct{}, 1)}
+	first, err := client.GetServiceRoot(context.TODO())
+	assert.NoError(t, err)
+
+	// Act
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	_, blockedErr := client.GetServiceRoot(ctx)
+	_ = first.Body.Close()
+	second, err := client.GetServiceRoot(context.TODO())
+
+	// Assert
+	assert.ErrorIs(t, blockedErr, context.DeadlineExceeded)
+	if assert.NoError(t, err) {
+		_ = second.Body.Close()
+	}
+	assert.Empty(t, client.requests)
+}
+
+func TestODataVersionFromMetadata(t *testing.T) {
+	// Arrange
+	var serviceRootRequests int
+	GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/$metadata" {
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="1.0" xmlns:edmx="http://schemas.microsoft.com/ado/2007/06/edmx">
+  <edmx:DataServices m:DataServiceVersion="2.0"
+    xmlns:m="http://schemas.microsoft.com/ado/2007/08/dataservices/metadata"/>
+</edmx:Edmx>`))
+			return
+		}
+		serviceRootRequests++
+		w.WriteHeader(http.StatusOK)
+	})
+	client := &ODataClientImpl{httpClient: oc.httpClient, baseUrl: oc.baseUrl}
+	_, err := newMetadataCache(0).get(context.TODO(), client, false)
+	assert.NoError(t, err)
+
+	// Act
+	version := client.odataVersion(context.TODO())
+
+	// Assert
+	assert.Equal(t, "2.0", version)
+	assert.Equal(t, 0, serviceRootRequests)
+}
+
+func TestODataVersionFallback(t *testing.T) {
+	// Arrange
+	client := &ODataClientImpl{httpClient: oc.httpClient, baseUrl: "http://127.0.0.1:1"}
+
+	// Act
+	version := client.odataVersion(context.TODO())
+
+	// Assert
+	assert.Equal(t, odata.V4, version)
+	assert.Equal(t, odata.V4, client.version)
+}
+
 func TestGetMetadata(t *testing.T) {
 	tables := []struct {
 		name             string
@@ -187,7 +548,7 @@ func TestGetMetadata(t *testing.T) {
 			client := GetOC("*", table.handlerCallback)
 
 			// Act
-			resp, err := client.GetMetadata(context.TODO())
+			resp, err := client.GetMetadata(context.TODO(), "")
 
 			// Assert
 			if table.expectedError == nil {
@@ -199,3 +560,20 @@ func TestGetMetadata(t *testing.T) {
 		})
 	}
 }
+
+func TestGetNextPageForeignHost(t *testing.T) {
+	// Arrange
+	requests := 0
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Act
+	resp, err := client.GetNextPage(context.TODO(), "http://attacker.example.com/Temperatures?$skiptoken=10")
+
+	// Assert
+	assert.Nil(t, resp)
+	assert.ErrorContains(t, err, "is not hosted by the service")
+	assert.Equal(t, 0, requests)
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const queryTypeCount = "count"
+
+// queryCount counts the entities matching the filters and the time range. The count is requested via the $count
+// path segment and, if the service does not support it, via $count=true with an empty page of entities. With a
+// time bucket, the entities are counted per interval like an aggregation with the count method.
+func (ds *ODataSource) queryCount(ctx context.Context, instance *ODataSourceInstance, query backend.DataQuery,
+	qm queryModel) backend.DataResponse {
+	response := backend.DataResponse{}
+	if qm.Count != nil && qm.Count.TimeBucket != "" {
+		qm.Aggregation = &aggregation{
+			Aggregates: []aggregate{{Method: odata.AggregateCount}},
+			TimeBucket: qm.Count.TimeBucket,
+		}
+		return ds.queryTimeBuckets(ctx, instance, query, qm)
+	}
+
+	options := queryOptions{
+		FilterConditions: append(qm.FilterConditions, TimeRangeToFilter(query.TimeRange, qm.TimeProperty)...),
+		Filter:           qm.Filter,
+		Search:           qm.Search,
+		CountOnly:        true,
+	}
+	stats := newRequestStats()
+	count, err := ds.readCount(ctx, instance, qm.EntitySet.Name, options, stats)
+	if err != nil && ctx.Err() == nil {
+		log.DefaultLogger.Debug("Counting via $count segment failed, falling back to inline count", "error", err)
+		options.CountOnly, options.InlineCount = false, true
+		stats = newRequestStats()
+		count, err = ds.readCount(ctx, instance, qm.EntitySet.Name, options, stats)
+	}
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	frame := data.NewFrame(query.RefID, data.NewField("count", nil, []int64{count}))
+	stats.apply(frame)
+	response.Frames = append(response.Frames, frame)
+	return response
+}
+
+func (ds *ODataSource) readCount(ctx context.Context, instance *ODataSourceInstance, entitySet string,
+	options queryOptions, stats *requestStats) (int64, error) {
+	resp, err := instance.client.Get(ctx, entitySet, options)
+	if err != nil {
+		return 0, err
+	}
+	stats.record(resp)
+	if !options.CountOnly {
+		result, err := readResponse(resp, nil, entityMaps(func(map[string]interface{}) {}))
+		if err != nil {
+			return 0, err
+		}
+		if result.Count == nil {
+			return 0, errors.New("the service did not return a count")
+		}
+		return *result.Count, nil
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return 0, newResponseError("get", resp)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	text := strings.TrimSpace(strings.TrimPrefix(string(body), "\ufeff"))
+	count, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count response: %q", text)
+	}
+	return count, nil
+}
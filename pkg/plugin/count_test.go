@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryCount(t *testing.T) {
+	tables := []struct {
+		name          string
+		handler       func(w http.ResponseWriter, r *http.Request)
+		expectedQuery string
+		expected      int64
+		expectedError string
+	}{
+		{
+			name: "Count segment",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/Temperatures/$count") {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte("42"))
+			},
+			expectedQuery: "$filter=int32 eq 5 and time ge 2022-04-21T12:30:50Z and time le 2022-04-21T12:30:50Z",
+			expected:      42,
+		},
+		{
+			name: "Inline count",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/$count") {
+					w.WriteHeader(http.StatusNotImplemented)
+					return
+				}
+				_, _ = w.Write([]byte(`{"@odata.count":17,"value":[]}`))
+			},
+			expectedQuery: "$count=true&$filter=int32 eq 5 and time ge 2022-04-21T12:30:50Z and " +
+				"time le 2022-04-21T12:30:50Z&$top=0",
+			expected: 17,
+		},
+		{
+			name: "V2 inline count",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(odata.HeaderDataServiceVersion, "2.0")
+				if strings.HasSuffix(r.URL.Path, "/$count") {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(`{"d":{"__count":"5","results":[]}}`))
+			},
+			expectedQuery: "$filter=int32 eq 5 and time ge datetimeoffset'2022-04-21T12:30:50Z' and " +
+				"time le datetimeoffset'2022-04-21T12:30:50Z'&$inlinecount=allpages&$top=0",
+			expected: 5,
+		},
+		{
+			name: "No count",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/$count") {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte(`{"value":[]}`))
+			},
+			expectedError: "the service did not return a count",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			var requestedQuery string
+			client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/" {
+					requestedQuery = r.URL.Query().Encode()
+				}
+				table.handler(w, r)
+			})
+			is := ODataSourceInstance{client: client}
+			ds := ODataSource{&managerMock{}}
+			query := aDataQuery("A", withQueryType(queryTypeCount),
+				withQueryModel(withTimeProperty("time"), withFilterConditions(int32Eq5)))
+
+			// Act
+			resp := ds.query(context.TODO(), &is, query)
+			withoutRequestStats(resp.Frames)
+
+			// Assert
+			if table.expectedError != "" {
+				assert.ErrorContains(t, resp.Error, table.expectedError)
+				return
+			}
+			assert.NoError(t, resp.Error)
+			decoded, _ := url.QueryUnescape(requestedQuery)
+			assert.Equal(t, table.expectedQuery, decoded)
+			assert.Equal(t, data.Frames{data.NewFrame("A", data.NewField("count", nil, []int64{table.expected}))},
+				resp.Frames)
+		})
+	}
+}
+
+func TestQueryCountPerTimeBucket(t *testing.T) {
+	// Arrange
+	var requestedApply string
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		requestedApply = r.URL.Query().Get(odata.Apply)
+		_, _ = w.Write([]byte(`{"value":[]}`))
+	})
+	is := ODataSourceInstance{client: client}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryType(queryTypeCount), withQueryModel(withTimeProperty("time"),
+		func(qm *queryModel) { qm.Count = &countOptions{TimeBucket: "1h"} }))
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+
+	// Assert
+	assert.NoError(t, resp.Error)
+	assert.Equal(t, "filter(time ge 2022-04-21T12:30:50Z and time le 2022-04-21T12:30:50Z)/"+
+		"compute(year(time) as time_year,month(time) as time_month,day(time) as time_day,hour(time) as time_hour)/"+
+		"groupby((time_year,time_month,time_day,time_hour),aggregate($count as count))", requestedApply)
+}
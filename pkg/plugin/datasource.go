@@ -3,11 +3,14 @@ package plugin
 import (
 	"context"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"runtime/debug"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -28,9 +31,31 @@ type ODataSource struct {
 	im instancemgmt.InstanceManager
 }
 
+// Upper bound of pages followed via @odata.nextLink if the data source settings do not specify one
+const defaultMaxPages = 100
+
+// Upper bounds of queries executed and requests sent concurrently if the data source settings do not specify them
+const (
+	defaultMaxConcurrentQueries  = 5
+	defaultMaxConcurrentRequests = 10
+)
+
 type DatasourceSettings struct {
 	URLSpaceEncoding string `json:"urlSpaceEncoding"`
 	OauthPassThru    bool   `json:"oauthPassThru"`
+	MaxPages         int    `json:"maxPages"`
+	MaxRows          int    `json:"maxRows"`
+	// MaxResponseSize is the maximum size in megabytes of the response bodies read for a query
+	MaxResponseSize int `json:"maxResponseSize"`
+	// MaxConcurrentQueries is the number of queries of a request executed concurrently
+	MaxConcurrentQueries int `json:"maxConcurrentQueries"`
+	// MaxConcurrentRequests is the number of requests sent to the service concurrently by all queries
+	MaxConcurrentRequests int `json:"maxConcurrentRequests"`
+	// BatchRequests combines the queries of a request into a single $batch request
+	BatchRequests bool `json:"batchRequests"`
+	// MetadataCacheTTL is the time in seconds the metadata is reused without revalidation. A negative value
+	// revalidates the metadata on every request.
+	MetadataCacheTTL int `json:"metadataCacheTtl"`
 }
 
 func newDatasourceInstance(ctx context.Context, settings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
@@ -55,13 +80,38 @@ func newDatasourceInstance(ctx context.Context, settings backend.DataSourceInsta
 		return nil, err
 	}
 
+	if dsSettings.MaxPages <= 0 {
+		dsSettings.MaxPages = defaultMaxPages
+	}
+	if dsSettings.MaxConcurrentQueries <= 0 {
+		dsSettings.MaxConcurrentQueries = defaultMaxConcurrentQueries
+	}
+	if dsSettings.MaxConcurrentRequests <= 0 {
+		dsSettings.MaxConcurrentRequests = defaultMaxConcurrentRequests
+	}
+
+	// With OAuth pass-through the metadata depends on the user, it is cached per request instead of being shared
+	var metadata *metadataCache
+	if !dsSettings.OauthPassThru {
+		metadata = newMetadataCache(dsSettings.MetadataCacheTTL)
+	}
+
 	return &ODataSourceInstance{
-		&ODataClientImpl{client, settings.URL, dsSettings.URLSpaceEncoding},
+		client: &ODataClientImpl{
+			httpClient:       client,
+			baseUrl:          settings.URL,
+			urlSpaceEncoding: dsSettings.URLSpaceEncoding,
+			requests:         make(chan struct{}, dsSettings.MaxConcurrentRequests),
+		},
+		settings: dsSettings,
+		metadata: metadata,
 	}, nil
 }
 
 type ODataSourceInstance struct {
-	client ODataClient
+	client   ODataClient
+	settings DatasourceSettings
+	metadata *metadataCache
 }
 
 func NewODataSource(ctx context.Context, _ backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
@@ -72,13 +122,28 @@ func NewODataSource(ctx context.Context, _ backend.DataSourceInstanceSettings) (
 	return ds, nil
 }
 
-func (ds *ODataSource) getClientInstance(ctx context.Context, pluginContext backend.PluginContext) (ODataClient, error) {
+// getInstance returns the instance for a single request. Without shared metadata cache, i.e. with OAuth
+// pass-through, the request gets a cache of its own, so that its queries load the metadata at most once.
+func (ds *ODataSource) getInstance(ctx context.Context, pluginContext backend.PluginContext) (*ODataSourceInstance, error) {
 	instance, err := ds.im.Get(ctx, pluginContext)
 	if err != nil {
 		return nil, err
 	}
-	clientInstance := instance.(*ODataSourceInstance).client
-	return clientInstance, nil
+	odataInstance := instance.(*ODataSourceInstance)
+	if odataInstance.metadata == nil {
+		requestInstance := *odataInstance
+		requestInstance.metadata = newMetadataCache(0)
+		return &requestInstance, nil
+	}
+	return odataInstance, nil
+}
+
+func (ds *ODataSource) getClientInstance(ctx context.Context, pluginContext backend.PluginContext) (ODataClient, error) {
+	instance, err := ds.getInstance(ctx, pluginContext)
+	if err != nil {
+		return nil, err
+	}
+	return instance.client, nil
 }
 
 func (ds *ODataSource) logTokenStatus(h http.Header) {
@@ -94,18 +159,90 @@ func (ds *ODataSource) logTokenStatus(h http.Header) {
 func (ds *ODataSource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse,
 	error) {
 	ds.logTokenStatus(req.GetHTTPHeaders())
-	clientInstance, err := ds.getClientInstance(ctx, req.PluginContext)
+	instance, err := ds.getInstance(ctx, req.PluginContext)
 	if err != nil {
 		return nil, err
 	}
 	response := backend.NewQueryDataResponse()
-	for _, q := range req.Queries {
-		res := ds.query(ctx, clientInstance, q)
-		response.Responses[q.RefID] = res
+	maxQueries := instance.settings.MaxConcurrentQueries
+	if maxQueries <= 0 {
+		maxQueries = defaultMaxConcurrentQueries
+	}
+	var b *batch
+	if instance.settings.BatchRequests && len(req.Queries) > 1 {
+		b = newBatch(ctx, instance.client, len(req.Queries), instance.settings.MaxResponseSize)
+	}
+	queryInstances := make([]*ODataSourceInstance, len(req.Queries))
+	for i := range req.Queries {
+		queryInstances[i] = instance
+		if b != nil {
+			batched := *instance
+			batched.client = b.newClient()
+			queryInstances[i] = &batched
+		}
+	}
+	if b != nil {
+		// The batch waits for all queries
+		maxQueries = len(req.Queries)
 	}
+
+	slots := make(chan struct{}, maxQueries)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, q := range req.Queries {
+		queryInstance := queryInstances[i]
+		if err := acquire(ctx, slots); err != nil {
+			finishQuery(queryInstance)
+			mu.Lock()
+			response.Responses[q.RefID] = backend.DataResponse{Error: err}
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer finishQuery(queryInstance)
+			res := ds.recoverQuery(ctx, queryInstance, q)
+			mu.Lock()
+			response.Responses[q.RefID] = res
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
 	return response, nil
 }
 
+// recoverQuery executes the query and reports a panic as error of the query, as it would otherwise terminate the
+// plugin from within the goroutine of the query
+func (ds *ODataSource) recoverQuery(ctx context.Context, instance *ODataSourceInstance,
+	query backend.DataQuery) (response backend.DataResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.DefaultLogger.Error("query panicked", "refId", query.RefID, "panic", r, "stack", string(debug.Stack()))
+			response = backend.DataResponse{Error: fmt.Errorf("query failed: %v", r)}
+		}
+	}()
+	return ds.query(ctx, instance, query)
+}
+
+// finishQuery releases the batch of the query, if any, from waiting for its request
+func finishQuery(instance *ODataSourceInstance) {
+	if client, ok := instance.client.(*batchClient); ok {
+		client.done()
+	}
+}
+
+// acquire takes one of the slots unless the context is done first
+func acquire(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (ds *ODataSource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult,
 	error) {
 	ds.logTokenStatus(req.GetHTTPHeaders())
@@ -144,7 +281,11 @@ func (ds *ODataSource) CallResource(ctx context.Context, req *backend.CallResour
 	ds.logTokenStatus(req.GetHTTPHeaders())
 	switch req.Path {
 	case "metadata":
-		return ds.getMetadata(ctx, req, sender)
+		return ds.getMetadata(ctx, req, sender, false)
+	case "metadata/refresh":
+		return ds.getMetadata(ctx, req, sender, true)
+	case "values":
+		return ds.getDistinctValues(ctx, req, sender)
 	default:
 		return sender.Send(&backend.CallResourceResponse{
 			Status: http.StatusNotFound,
@@ -152,28 +293,41 @@ func (ds *ODataSource) CallResource(ctx context.Context, req *backend.CallResour
 	}
 }
 
-func (ds *ODataSource) query(ctx context.Context, clientInstance ODataClient, query backend.DataQuery) backend.DataResponse {
+func (ds *ODataSource) query(ctx context.Context, instance *ODataSourceInstance,
+	query backend.DataQuery) (response backend.DataResponse) {
 	log.DefaultLogger.Debug("query", "query.JSON", string(query.JSON))
-	response := backend.DataResponse{}
+	defer setErrorStatus(&response)
 	var qm queryModel
 	err := json.Unmarshal(query.JSON, &qm)
 	if err != nil {
 		response.Error = fmt.Errorf("error unmarshalling query json: %w", err)
 		return response
 	}
+	if err := qm.interpolate(); err != nil {
+		response.Error = err
+		return response
+	}
+	if err := ds.resolveFilterTypes(ctx, instance, qm.FilterConditions, qm.Filter); err != nil {
+		response.Error = err
+		return response
+	}
+
+	switch query.QueryType {
+	case queryTypeAggregation:
+		return ds.queryAggregation(ctx, instance, query, qm)
+	case queryTypeAnnotations:
+		return ds.queryAnnotations(ctx, instance, query, qm)
+	case queryTypeCount:
+		return ds.queryCount(ctx, instance, query, qm)
+	}
 
 	// Prevent empty queries from being executed
 	if qm.TimeProperty == nil && len(qm.Properties) == 0 {
 		return response
 	}
 
-	frame := data.NewFrame("response")
-	frame.Name = query.RefID
-	if frame.Meta == nil {
-		frame.Meta = &data.FrameMeta{}
-	}
-	frame.Meta.PreferredVisualization = data.VisTypeTable
-
+	frame := newFrame(query.RefID)
+	var columns []property
 	if qm.TimeProperty != nil {
 		log.DefaultLogger.Debug("Time property configured", "name", qm.TimeProperty.Name)
 		labels, err := data.LabelsFromString("time=" + qm.TimeProperty.Name)
@@ -183,103 +337,316 @@ func (ds *ODataSource) query(ctx context.Context, clientInstance ODataClient, qu
 		}
 		field := data.NewField(qm.TimeProperty.Name, labels, odata.ToArray(qm.TimeProperty.Type))
 		frame.Fields = append(frame.Fields, field)
+		columns = append(columns, *qm.TimeProperty)
 	}
-	for _, prop := range qm.Properties {
+	selected := qm.Properties
+	if qm.NumericEnums {
+		selected = slices.Clone(qm.Properties)
+		if err := ds.resolveEnums(ctx, instance, selected); err != nil {
+			response.Error = fmt.Errorf("error resolving enum types: %w", err)
+			return response
+		}
+	}
+	explode := -1
+	for _, prop := range selected {
+		if qm.Explode != "" && prop.Name == qm.Explode {
+			elementType, ok := odata.ElementType(prop.Type)
+			if !ok {
+				response.Error = fmt.Errorf("explode property %s is not a collection", prop.Name)
+				return response
+			}
+			if !strings.HasPrefix(elementType, "Edm.") {
+				// Elements of complex types are kept as JSON
+				elementType = odata.EdmUntyped
+			}
+			explode = len(columns)
+			prop.Type = elementType
+		}
 		field := data.NewField(prop.Name, nil, odata.ToArray(prop.Type))
 		frame.Fields = append(frame.Fields, field)
+		columns = append(columns, prop)
+	}
+	if qm.Explode != "" && explode < 0 {
+		response.Error = fmt.Errorf("explode property %s is not selected", qm.Explode)
+		return response
 	}
 
 	props := qm.Properties
 	if qm.TimeProperty != nil {
 		props = append(props, *qm.TimeProperty)
 	}
-	resp, err := clientInstance.Get(ctx, qm.EntitySet.Name, props,
-		append(qm.FilterConditions, TimeRangeToFilter(query.TimeRange, qm.TimeProperty)...))
+	props, err = ds.resolveSelectPaths(ctx, instance, qm.EntitySet.Name, props)
 	if err != nil {
 		response.Error = err
 		return response
 	}
-
-	defer func() { _ = resp.Body.Close() }()
-
-	log.DefaultLogger.Debug("request response status", "status", resp.Status)
-	if resp.StatusCode != http.StatusOK {
-		response.Error = fmt.Errorf("get failed with status code %d", resp.StatusCode)
-		return response
+	sortOrder := qm.OrderBy
+	if len(sortOrder) == 0 && qm.TimeProperty != nil {
+		// Time series are sorted by time
+		sortOrder = []orderBy{{Property: *qm.TimeProperty}}
 	}
-	bodyBytes, err := io.ReadAll(resp.Body)
+	stats := newRequestStats()
+	resp, err := instance.client.Get(ctx, qm.EntitySet.Name, queryOptions{
+		Properties:       props,
+		FilterConditions: append(qm.FilterConditions, TimeRangeToFilter(query.TimeRange, qm.TimeProperty)...),
+		Filter:           qm.Filter,
+		Search:           qm.Search,
+		OrderBy:          sortOrder,
+		Top:              qm.Top,
+	})
 	if err != nil {
 		response.Error = err
 		return response
 	}
-	var result odata.Response
-	err = json.Unmarshal(bodyBytes, &result)
-	if err != nil {
+
+	if err := ds.readFrame(ctx, instance, resp, stats, frame, columns, explode); err != nil {
 		response.Error = err
 		return response
 	}
 
-	log.DefaultLogger.Debug("query complete", "noOfEntities", len(result.Value))
+	stats.apply(frame)
+	response.Frames = append(response.Frames, frame)
+	return response
+}
 
-	for _, entry := range result.Value {
-		var values []interface{}
+func newFrame(refID string) *data.Frame {
+	frame := data.NewFrame("response")
+	frame.Name = refID
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	frame.Meta.PreferredVisualization = data.VisTypeTable
+	return frame
+}
 
-		if qm.TimeProperty != nil {
-			values = make([]interface{}, len(qm.Properties)+1)
-			values[0] = odata.MapValue(entry[qm.TimeProperty.Name], qm.TimeProperty.Type)
-		} else {
-			values = make([]interface{}, len(qm.Properties))
-		}
+// readFrame appends the entities of the response and all following pages to the frame, one field per column. The
+// collection column at index explode, if any, is exploded into one row per element.
+func (ds *ODataSource) readFrame(ctx context.Context, instance *ODataSourceInstance, resp *http.Response,
+	stats *requestStats, frame *data.Frame, columns []property, explode int) error {
+	notice, err := ds.readPages(ctx, instance, resp, stats, newRowReader(frame, columns, explode).read)
+	if err != nil {
+		return err
+	}
+	if notice != nil {
+		frame.AppendNotices(*notice)
+	}
+	return nil
+}
 
-		for i, prop := range qm.Properties {
-			index := i
-			if qm.TimeProperty != nil {
-				index++
+// readPages passes the entities of the response and all following pages to readEntity until the result is complete
+// or the page/row/size limits of the data source are reached. The pages are decoded as a stream, readEntity reads one
+// entity from the decoder at a time. If the result was truncated, a notice is returned. The pages are recorded in
+// stats, which may be nil.
+func (ds *ODataSource) readPages(ctx context.Context, instance *ODataSourceInstance, resp *http.Response,
+	stats *requestStats, readEntity func(dec *json.Decoder) error) (*data.Notice, error) {
+	maxPages := instance.settings.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+	maxRows := instance.settings.MaxRows
+	limit := newResponseLimit(instance.settings.MaxResponseSize)
+	rows := 0
+	for page := 1; ; page++ {
+		stats.record(resp)
+		pageRows := 0
+		result, err := readResponse(resp, limit, func(dec *json.Decoder) error {
+			if maxRows > 0 && rows >= maxRows {
+				// The service provides more rows than the limit, the rest of the page is not read
+				return errRowLimitReached
 			}
-
-			if value, ok := entry[prop.Name]; ok {
-				values[index] = odata.MapValue(value, prop.Type)
-			} else {
-				values[index] = nil
+			if err := readEntity(dec); err != nil {
+				return err
 			}
+			rows++
+			pageRows++
+			return nil
+		})
+		moreRows := errors.Is(err, errRowLimitReached)
+		if err != nil && !moreRows {
+			return nil, err
+		}
+
+		log.DefaultLogger.Debug("page complete", "page", page, "noOfEntities", pageRows)
+
+		if !moreRows && result.NextLink == "" {
+			return nil, nil
+		}
+		rowLimitReached := maxRows > 0 && rows >= maxRows
+		if rowLimitReached || page >= maxPages {
+			return &data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text: fmt.Sprintf("Result truncated to %d rows from %d pages. The service provides more data; "+
+					"narrow the query or raise the row/page limit in the data source settings.", rows, page),
+			}, nil
+		}
+
+		resp, err = instance.client.GetNextPage(ctx, result.NextLink)
+		if err != nil {
+			return nil, err
 		}
-		frame.AppendRow(values...)
 	}
-	response.Frames = append(response.Frames, frame)
-	return response
 }
 
-func (ds *ODataSource) getMetadata(ctx context.Context, req *backend.CallResourceRequest,
-	sender backend.CallResourceResponseSender) error {
-	clientInstance, err := ds.getClientInstance(ctx, req.PluginContext)
-	if err != nil {
-		return err
+// readResponse decodes and closes the body of a single OData response page, passing the decoder to onEntity for each
+// entity. The body is read within the given limit, which may be nil.
+func readResponse(resp *http.Response, limit *responseLimit,
+	onEntity func(dec *json.Decoder) error) (*odata.Response, error) {
+	defer func() { _ = resp.Body.Close() }()
+
+	log.DefaultLogger.Debug("request response status", "status", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return nil, newResponseError("get", resp)
+	}
+	var body io.Reader = resp.Body
+	if limit != nil {
+		body = &limitedBody{body: resp.Body, limit: limit}
 	}
-	resp, err := clientInstance.GetMetadata(ctx)
+	return odata.DecodeResponse(body, onEntity)
+}
 
+// entityMaps adapts a function processing whole entities to readPages, for results which are not read into the
+// fields of a frame directly, e.g. entities grouped into time buckets
+func entityMaps(process func(entity map[string]interface{})) func(dec *json.Decoder) error {
+	return func(dec *json.Decoder) error {
+		var entity map[string]interface{}
+		if err := dec.Decode(&entity); err != nil {
+			return err
+		}
+		process(entity)
+		return nil
+	}
+}
+
+// rowReader decodes entities straight into the fields of a frame, one field per column. Only the properties the
+// columns are read from are decoded, e.g. "Address" for the column "Address.City".
+type rowReader struct {
+	frame   *data.Frame
+	columns []property
+	// explode is the index of a column whose type is the element type of the collection; each element of that column
+	// gets a row of its own, an empty or null collection a single row without element
+	explode int
+	// columnsByProperty lists the columns read from each property of the entity
+	columnsByProperty map[string][]int
+	values            []interface{}
+	elements          []interface{}
+}
+
+func newRowReader(frame *data.Frame, columns []property, explode int) *rowReader {
+	r := &rowReader{
+		frame:             frame,
+		columns:           columns,
+		explode:           explode,
+		columnsByProperty: make(map[string][]int),
+		values:            make([]interface{}, len(columns)),
+	}
+	for i, column := range columns {
+		name, _, _ := splitPath(column.Name)
+		r.columnsByProperty[name] = append(r.columnsByProperty[name], i)
+	}
+	return r
+}
+
+// read decodes an entity and appends its rows to the fields of the frame
+func (r *rowReader) read(dec *json.Decoder) error {
+	clear(r.values)
+	r.elements = nil
+	err := odata.DecodeEntity(dec, func(name string) bool {
+		_, ok := r.columnsByProperty[name]
+		return ok
+	}, r.setValues)
 	if err != nil {
 		return err
 	}
+	if len(r.elements) == 0 {
+		r.appendRow()
+		return nil
+	}
+	for _, element := range r.elements {
+		r.values[r.explode] = odata.MapValue(element, r.columns[r.explode].Type)
+		r.appendRow()
+	}
+	return nil
+}
 
-	defer func() { _ = resp.Body.Close() }()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("get metadata failed with status code %d", resp.StatusCode)
+// setValues maps the value of a property of the entity to the values of the columns read from it
+func (r *rowReader) setValues(name string, value interface{}) {
+	for _, i := range r.columnsByProperty[name] {
+		column := r.columns[i]
+		columnValue, ok := value, true
+		if _, rest, nested := splitPath(column.Name); nested {
+			related, isObject := value.(map[string]interface{})
+			if !isObject {
+				// Not expanded, null or collection-valued
+				continue
+			}
+			columnValue, ok = odata.LookupValue(related, rest)
+		}
+		switch {
+		case !ok:
+		case i == r.explode:
+			r.elements, _ = columnValue.([]interface{})
+		case column.enum != nil:
+			r.values[i] = column.enum.number(columnValue)
+		default:
+			r.values[i] = odata.MapValue(columnValue, column.Type)
+		}
+	}
+}
+
+func (r *rowReader) appendRow() {
+	for i, field := range r.frame.Fields {
+		field.Append(r.values[i])
+	}
+}
+
+// splitPath splits a property path into the name of the property of the entity and the path within its value
+func splitPath(path string) (name string, rest string, nested bool) {
+	if i := strings.IndexAny(path, "/."); i >= 0 {
+		return path[:i], path[i+1:], true
 	}
-	bodyBytes, err := io.ReadAll(resp.Body)
+	return path, "", false
+}
+
+func (ds *ODataSource) getMetadata(ctx context.Context, req *backend.CallResourceRequest,
+	sender backend.CallResourceResponseSender, refresh bool) error {
+	instance, err := ds.getInstance(ctx, req.PluginContext)
 	if err != nil {
-		log.DefaultLogger.Error("error reading response body")
 		return err
 	}
-	var edmx odata.Edmx
-	err = xml.Unmarshal(bodyBytes, &edmx)
+	metadata, err := instance.metadata.get(ctx, instance.client, refresh)
 	if err != nil {
-		log.DefaultLogger.Error("error unmarshalling response body")
 		return err
 	}
 
-	metadata := schema{
-		EntityTypes: make(map[string]entityType),
-		EntitySets:  make(map[string]entitySet),
+	responseBody, err := json.Marshal(metadata)
+	if err != nil {
+		log.DefaultLogger.Error("error marshalling response body")
+		return err
+	}
+	return sender.Send(&backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   responseBody,
+	})
+}
+
+// newSchema maps the metadata document to the schema of the service
+func newSchema(edmx odata.Edmx, version string) *schema {
+	normalizeAliases(edmx)
+	metadata := &schema{
+		Version:         version,
+		EntityTypes:     make(map[string]entityType),
+		ComplexTypes:    make(map[string]complexType),
+		EnumTypes:       make(map[string]enumType),
+		TypeDefinitions: make(map[string]string),
+		EntitySets:      make(map[string]entitySet),
+	}
+	associations := make(map[string]*odata.Association)
+	for _, ds := range edmx.DataServices {
+		for _, s := range ds.Schemas {
+			for _, a := range s.Associations {
+				associations[s.Namespace+"."+a.Name] = a
+			}
+		}
 	}
 	for _, ds := range edmx.DataServices {
 		for _, s := range ds.Schemas {
@@ -293,12 +660,44 @@ func (ds *ODataSource) getMetadata(ctx context.Context, req *backend.CallResourc
 					}
 					properties = append(properties, prop)
 				}
+				var navigationProperties []navigationProperty
+				for _, np := range et.NavigationProperties {
+					navigationProperties = append(navigationProperties, mapNavigationProperty(np, associations))
+				}
+				var key []string
+				for _, k := range et.Key {
+					for _, ref := range k.PropertyRef {
+						key = append(key, ref.Name)
+					}
+				}
 				metadata.EntityTypes[qualifiedName] = entityType{
-					Name:          et.Name,
+					Name:                 et.Name,
+					QualifiedName:        qualifiedName,
+					BaseType:             et.BaseType,
+					Abstract:             et.Abstract,
+					Key:                  key,
+					Properties:           properties,
+					NavigationProperties: navigationProperties,
+				}
+			}
+			for _, ct := range s.ComplexTypes {
+				qualifiedName := s.Namespace + "." + ct.Name
+				var properties []property
+				for _, p := range ct.Properties {
+					properties = append(properties, property{Name: p.Name, Type: p.Type})
+				}
+				metadata.ComplexTypes[qualifiedName] = complexType{
+					Name:          ct.Name,
 					QualifiedName: qualifiedName,
 					Properties:    properties,
 				}
 			}
+			for _, et := range s.EnumTypes {
+				metadata.EnumTypes[s.Namespace+"."+et.Name] = newEnumType(s.Namespace, et)
+			}
+			for _, td := range s.TypeDefinitions {
+				metadata.TypeDefinitions[s.Namespace+"."+td.Name] = td.UnderlyingType
+			}
 			for _, ec := range s.EntityContainers {
 				for _, es := range ec.EntitySet {
 					metadata.EntitySets[es.Name] = entitySet{
@@ -309,14 +708,32 @@ func (ds *ODataSource) getMetadata(ctx context.Context, req *backend.CallResourc
 			}
 		}
 	}
+	inheritEntityTypes(metadata.EntityTypes)
+	if !odata.IsV2(version) {
+		addTypeCastEntitySets(metadata)
+	}
+	return metadata
+}
 
-	responseBody, err := json.Marshal(metadata)
-	if err != nil {
-		log.DefaultLogger.Error("error marshalling response body")
-		return err
+// mapNavigationProperty resolves the target entity type of a navigation property, either from its V4 type or from the
+// referenced V2 association
+func mapNavigationProperty(np *odata.NavigationProperty, associations map[string]*odata.Association) navigationProperty {
+	result := navigationProperty{Name: np.Name}
+	if np.Type != "" {
+		result.EntityType = np.Type
+		if strings.HasPrefix(np.Type, "Collection(") && strings.HasSuffix(np.Type, ")") {
+			result.EntityType = np.Type[len("Collection(") : len(np.Type)-1]
+			result.Collection = true
+		}
+		return result
 	}
-	return sender.Send(&backend.CallResourceResponse{
-		Status: http.StatusOK,
-		Body:   responseBody,
-	})
+	if association, ok := associations[np.Relationship]; ok {
+		for _, end := range association.Ends {
+			if end.Role == np.ToRole {
+				result.EntityType = end.Type
+				result.Collection = end.Multiplicity == "*"
+			}
+		}
+	}
+	return result
 }
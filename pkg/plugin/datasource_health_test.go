@@ -15,7 +15,7 @@ func TestCheckHealth(t *testing.T) {
 	im := managerMock{}
 	ds := ODataSource{&im}
 
-	is := ODataSourceInstance{GetOC("/", func(w http.ResponseWriter, r *http.Request) {
+	is := ODataSourceInstance{client: GetOC("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})}
 
@@ -31,7 +31,7 @@ func TestCheckHealthWithError(t *testing.T) {
 	im := managerMock{}
 	ds := ODataSource{&im}
 
-	is := ODataSourceInstance{GetOC("/not/found", nil)}
+	is := ODataSourceInstance{client: GetOC("/not/found", nil)}
 
 	im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
 
@@ -45,7 +45,7 @@ func TestCheckHealthTimeout(t *testing.T) {
 	im := managerMock{}
 	ds := ODataSource{&im}
 
-	is := ODataSourceInstance{GetOC("/", func(w http.ResponseWriter, r *http.Request) {
+	is := ODataSourceInstance{client: GetOC("/", func(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(2 * time.Second)
 		w.WriteHeader(http.StatusOK)
 	})}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -47,7 +49,7 @@ func TestQueryData(t *testing.T) {
 
 			body, _ := json.Marshal(odata.Response{})
 			client := clientMock{body: body}
-			is := ODataSourceInstance{&client}
+			is := ODataSourceInstance{client: &client}
 			im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
 
 			// Act
@@ -60,6 +62,125 @@ func TestQueryData(t *testing.T) {
 	}
 }
 
+func TestQueryDataConcurrently(t *testing.T) {
+	// Arrange
+	var inFlight, maxInFlight atomic.Int32
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			previous := maxInFlight.Load()
+			if current <= previous || maxInFlight.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		body, _ := json.Marshal(anOdataResponse(withDefaultEntity()))
+		_, _ = w.Write(body)
+	})
+	im := managerMock{}
+	ds := ODataSource{&im}
+	is := ODataSourceInstance{client: client, settings: DatasourceSettings{MaxConcurrentQueries: 2}}
+	im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
+	refIds := []string{"A", "B", "C", "D", "E"}
+	var builders []func(*backend.QueryDataRequest)
+	for _, refId := range refIds {
+		builders = append(builders, withDataQuery(refId, withQueryModel(withTimeProperty("time"))))
+	}
+	req := aQueryDataRequest(builders...)
+
+	// Act
+	result, err := ds.QueryData(context.TODO(), &req)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), maxInFlight.Load())
+	assert.Len(t, result.Responses, len(refIds))
+	for _, refId := range refIds {
+		if assert.NoError(t, result.Responses[refId].Error) {
+			assert.Equal(t, refId, result.Responses[refId].Frames[0].Name)
+		}
+	}
+}
+
+func TestQueryDataCancelled(t *testing.T) {
+	// Arrange
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := json.Marshal(anOdataResponse(withDefaultEntity()))
+		_, _ = w.Write(body)
+	})
+	im := managerMock{}
+	ds := ODataSource{&im}
+	is := ODataSourceInstance{client: client, settings: DatasourceSettings{MaxConcurrentQueries: 1}}
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	im.On("Get", ctx, mock.Anything).Return(&is, nil)
+	req := aQueryDataRequest(withDataQuery("A", withQueryModel(withTimeProperty("time"))),
+		withDataQuery("B", withQueryModel(withTimeProperty("time"))))
+
+	// Act
+	result, err := ds.QueryData(ctx, &req)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, result.Responses, 2)
+	for _, response := range result.Responses {
+		assert.ErrorIs(t, response.Error, context.Canceled)
+	}
+}
+
+func TestQueryDataMetadataPerRequest(t *testing.T) {
+	// Arrange
+	var metadataRequests atomic.Int32
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/$metadata" {
+			metadataRequests.Add(1)
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="4.0" xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx">
+  <edmx:DataServices>
+    <Schema Namespace="NS" xmlns="http://docs.oasis-open.org/odata/ns/edm">
+      <EnumType Name="Status"><Member Name="Open"/><Member Name="Closed"/></EnumType>
+      <EntityType Name="Temperature">
+        <Property Name="Status" Type="NS.Status"/>
+        <NavigationProperty Name="Sensor" Type="NS.Sensor"/>
+      </EntityType>
+      <EntityType Name="Sensor">
+        <Property Name="Name" Type="Edm.String"/>
+      </EntityType>
+      <EntityContainer Name="Container">
+        <EntitySet Name="Temperatures" EntityType="NS.Temperature"/>
+      </EntityContainer>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>`))
+			return
+		}
+		body, _ := json.Marshal(anOdataResponse())
+		_, _ = w.Write(body)
+	})
+	im := managerMock{}
+	ds := ODataSource{&im}
+	// No shared metadata cache as with OAuth pass-through
+	is := ODataSourceInstance{client: client}
+	im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
+	status := func(p *property) { p.Name, p.Type = "Status", "NS.Status" }
+	sensorName := func(p *property) { p.Name, p.Type = "Sensor/Name", odata.EdmString }
+	query := withQueryModel(withProperties(status, sensorName), withFilterConditions(
+		withFilterCondition(status, "eq", "Open")), func(qm *queryModel) { qm.NumericEnums = true })
+	req := aQueryDataRequest(withDataQuery("A", query), withDataQuery("B", query))
+
+	// Act
+	result, err := ds.QueryData(context.TODO(), &req)
+
+	// Assert
+	assert.NoError(t, err)
+	for _, response := range result.Responses {
+		assert.NoError(t, response.Error)
+	}
+	assert.Equal(t, int32(1), metadataRequests.Load())
+	assert.Nil(t, is.metadata)
+}
+
 func TestQuery(t *testing.T) {
 	tables := []struct {
 		name              string
@@ -158,6 +279,115 @@ func TestQuery(t *testing.T) {
 				),
 			)),
 		},
+		{
+			name: "success expanded navigation properties",
+			query: aDataQuery("defaultTestFrame", withQueryModel(withProperties(int32Prop,
+				func(p *property) { p.Name, p.Type = "Sensor/Name", odata.EdmString },
+				func(p *property) { p.Name, p.Type = "Sensor/Room/Name", odata.EdmString }))),
+			mockODataResponse: anOdataResponse(
+				withEntity(
+					withProp("int32", 10.0),
+					withProp("Sensor", map[string]interface{}{
+						"Name": "S1",
+						"Room": map[string]interface{}{"Name": "Kitchen"},
+					})),
+				withEntity(
+					withProp("int32", 11.0),
+					withProp("Sensor", nil)),
+			),
+			expected: aDataResponse(withBaseFrame("defaultTestFrame",
+				withField("int32", []*int32{}),
+				withField("Sensor/Name", []*string{}),
+				withField("Sensor/Room/Name", []*string{}),
+				withRow(
+					withRowValue(int32(10)),
+					withRowValue("S1"),
+					withRowValue("Kitchen"),
+				),
+				withRow(
+					withRowValue(int32(11)),
+					nil, nil,
+				),
+			)),
+		},
+		{
+			name: "success complex type properties",
+			query: aDataQuery("defaultTestFrame", withQueryModel(withProperties(cityProp,
+				func(p *property) { p.Name, p.Type = "Address/Location/Floor", odata.EdmInt32 },
+				func(p *property) { p.Name, p.Type = "Sensor/Address/City", odata.EdmString }))),
+			mockODataResponse: anOdataResponse(
+				withEntity(
+					withProp("Address", map[string]interface{}{
+						"City":     "Berlin",
+						"Location": map[string]interface{}{"Floor": 3.0},
+					}),
+					withProp("Sensor", map[string]interface{}{
+						"Address": map[string]interface{}{"City": "Bonn"},
+					})),
+				withEntity(
+					withProp("Address", nil)),
+			),
+			expected: aDataResponse(withBaseFrame("defaultTestFrame",
+				withField("Address/City", []*string{}),
+				withField("Address/Location/Floor", []*int32{}),
+				withField("Sensor/Address/City", []*string{}),
+				withRow(
+					withRowValue("Berlin"),
+					withRowValue(int32(3)),
+					withRowValue("Bonn"),
+				),
+				withRow(nil, nil, nil),
+			)),
+		},
+		{
+			name: "success collection and untyped properties as JSON",
+			query: aDataQuery("defaultTestFrame", withQueryModel(withProperties(tagsProp,
+				func(p *property) { p.Name, p.Type = "Readings", "Collection(NS.Reading)" },
+				func(p *property) { p.Name, p.Type = "Extra", odata.EdmUntyped },
+				func(p *property) { p.Name, p.Type = "Dynamic", "" }))),
+			mockODataResponse: anOdataResponse(
+				withEntity(
+					withProp("Tags", []interface{}{"a", "b"}),
+					withProp("Readings", []interface{}{map[string]interface{}{"Value": 1.5}}),
+					withProp("Extra", 12345678901234567),
+					withProp("Dynamic", map[string]interface{}{"a": 1})),
+				withEntity(
+					withProp("Tags", nil)),
+			),
+			expected: aDataResponse(withBaseFrame("defaultTestFrame",
+				withField("Tags", []*json.RawMessage{}),
+				withField("Readings", []*json.RawMessage{}),
+				withField("Extra", []*json.RawMessage{}),
+				withField("Dynamic", []*string{}),
+				withRow(
+					withRowValue(json.RawMessage(`["a","b"]`)),
+					withRowValue(json.RawMessage(`[{"Value":1.5}]`)),
+					withRowValue(json.RawMessage(`12345678901234567`)),
+					withRowValue(`{"a":1}`),
+				),
+				withRow(nil, nil, nil, nil),
+			)),
+		},
+		{
+			name: "success explode collection",
+			query: aDataQuery("defaultTestFrame", withQueryModel(withProperties(int32Prop, tagsProp),
+				withExplode("Tags"))),
+			mockODataResponse: anOdataResponse(
+				withEntity(
+					withProp("int32", 1.0),
+					withProp("Tags", []interface{}{"a", "b"})),
+				withEntity(
+					withProp("int32", 2.0),
+					withProp("Tags", []interface{}{})),
+			),
+			expected: aDataResponse(withBaseFrame("defaultTestFrame",
+				withField("int32", []*int32{}),
+				withField("Tags", []*string{}),
+				withRow(withRowValue(int32(1)), withRowValue("a")),
+				withRow(withRowValue(int32(1)), withRowValue("b")),
+				withRow(withRowValue(int32(2)), nil),
+			)),
+		},
 		{
 			name:              "success minimal",
 			query:             aDataQuery("baseFrame", withQueryModel()),
@@ -209,11 +439,16 @@ func TestQuery(t *testing.T) {
 				err:        table.expected.Error,
 				statusCode: 200,
 			}
-			is := ODataSourceInstance{&client}
+			metadata := temperatureSchema()
+			is := ODataSourceInstance{
+				client:   &client,
+				metadata: &metadataCache{ttl: time.Hour, schema: &metadata, expires: time.Now().Add(time.Hour)},
+			}
 			im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
 
 			// Act
-			resp := ds.query(context.TODO(), &client, table.query)
+			resp := ds.query(context.TODO(), &is, table.query)
+			withoutRequestStats(resp.Frames)
 
 			// Assert
 			assert.Equal(t, table.expected, resp)
@@ -234,6 +469,16 @@ func TestInvalidQueryModels(t *testing.T) {
 			},
 			expectedErrorMsg: "error unmarshalling query json",
 		},
+		{
+			name:             "Explode non-collection",
+			query:            aDataQuery("A", withQueryModel(withProperties(int32Prop), withExplode("int32"))),
+			expectedErrorMsg: "explode property int32 is not a collection",
+		},
+		{
+			name:             "Explode not selected",
+			query:            aDataQuery("A", withQueryModel(withProperties(int32Prop), withExplode("Tags"))),
+			expectedErrorMsg: "explode property Tags is not selected",
+		},
 	}
 
 	for _, table := range tables {
@@ -243,11 +488,11 @@ func TestInvalidQueryModels(t *testing.T) {
 			ds := ODataSource{&im}
 
 			client := clientMock{}
-			is := ODataSourceInstance{&client}
+			is := ODataSourceInstance{client: &client}
 			im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
 
 			// Act
-			resp := ds.query(context.TODO(), &client, table.query)
+			resp := ds.query(context.TODO(), &is, table.query)
 
 			// Assert
 			assert.NotNil(t, resp.Error)
@@ -255,3 +500,221 @@ func TestInvalidQueryModels(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryPaging(t *testing.T) {
+	tables := []struct {
+		name            string
+		settings        DatasourceSettings
+		expectedRows    int
+		expectedNotices int
+		expectedPages   float64
+	}{
+		{
+			name:          "All pages",
+			settings:      DatasourceSettings{},
+			expectedRows:  6,
+			expectedPages: 3,
+		},
+		{
+			name:            "Page limit",
+			settings:        DatasourceSettings{MaxPages: 2},
+			expectedRows:    4,
+			expectedNotices: 1,
+			expectedPages:   2,
+		},
+		{
+			name:            "Row limit",
+			settings:        DatasourceSettings{MaxRows: 3},
+			expectedRows:    3,
+			expectedNotices: 1,
+			expectedPages:   2,
+		},
+		{
+			name:            "Row limit within first page",
+			settings:        DatasourceSettings{MaxRows: 1},
+			expectedRows:    1,
+			expectedNotices: 1,
+			expectedPages:   1,
+		},
+		{
+			name:          "Row limit matches result size",
+			settings:      DatasourceSettings{MaxRows: 6},
+			expectedRows:  6,
+			expectedPages: 3,
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+				var page odata.Response
+				switch r.URL.Query().Get("$skiptoken") {
+				case "":
+					page = anOdataResponse(withDefaultEntity(), withDefaultEntity())
+					page.NextLink = "Temperatures?$skiptoken=2"
+				case "2":
+					page = anOdataResponse(withDefaultEntity(), withDefaultEntity())
+					page.NextLink = "Temperatures?$skiptoken=4"
+				default:
+					page = anOdataResponse(withDefaultEntity(), withDefaultEntity())
+				}
+				body, _ := json.Marshal(page)
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(body)
+			})
+			is := ODataSourceInstance{client: client, settings: table.settings}
+			ds := ODataSource{&managerMock{}}
+			query := aDataQuery("A", withQueryModel(withTimeProperty("time"),
+				withProperties(int32Prop, booleanProp, stringProp)))
+
+			// Act
+			resp := ds.query(context.TODO(), &is, query)
+
+			// Assert
+			assert.NoError(t, resp.Error)
+			assert.Len(t, resp.Frames, 1)
+			assert.Equal(t, table.expectedRows, resp.Frames[0].Rows())
+			assert.Len(t, resp.Frames[0].Meta.Notices, table.expectedNotices)
+			assert.Contains(t, resp.Frames[0].Meta.ExecutedQueryString, "/Temperatures?%24filter=")
+			assert.NotContains(t, resp.Frames[0].Meta.ExecutedQueryString, "skiptoken")
+			assert.Equal(t, "Pages", resp.Frames[0].Meta.Stats[0].DisplayName)
+			assert.Equal(t, table.expectedPages, resp.Frames[0].Meta.Stats[0].Value)
+		})
+	}
+}
+
+func TestQueryOrderBy(t *testing.T) {
+	tables := []struct {
+		name            string
+		queryModel      func(*backend.DataQuery)
+		expectedOrderBy string
+		expectedTop     string
+	}{
+		{
+			name:            "Time series ordered by time",
+			queryModel:      withQueryModel(withTimeProperty("time"), withProperties(int32Prop)),
+			expectedOrderBy: "time",
+		},
+		{
+			name:       "Table without order",
+			queryModel: withQueryModel(withProperties(int32Prop)),
+		},
+		{
+			name: "Top by value",
+			queryModel: withQueryModel(withTimeProperty("time"), withProperties(int32Prop),
+				withOrderBy(int32Prop, "desc"), withTop(10)),
+			expectedOrderBy: "int32 desc",
+			expectedTop:     "10",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			var requestedOrderBy, requestedTop string
+			client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+				requestedOrderBy = r.URL.Query().Get(odata.OrderBy)
+				requestedTop = r.URL.Query().Get(odata.Top)
+				body, _ := json.Marshal(anOdataResponse())
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(body)
+			})
+			is := ODataSourceInstance{client: client}
+			ds := ODataSource{&managerMock{}}
+			query := aDataQuery("A", table.queryModel)
+
+			// Act
+			resp := ds.query(context.TODO(), &is, query)
+
+			// Assert
+			assert.NoError(t, resp.Error)
+			assert.Equal(t, table.expectedOrderBy, requestedOrderBy)
+			assert.Equal(t, table.expectedTop, requestedTop)
+		})
+	}
+}
+
+func TestQueryODataV2(t *testing.T) {
+	tables := []struct {
+		name     string
+		body     string
+		expected backend.DataResponse
+	}{
+		{
+			name: "V2 results",
+			body: `{"d":{"results":[{"__metadata":{"type":"NS.Temperature"},"datetime":"/Date(1641081600000)/",` +
+				`"int64":"9007199254740993","decimal":"1.5"}]}}`,
+			expected: aDataResponse(withBaseFrame("A",
+				withTimeField("datetime", true),
+				withField("int64", []*int64{}),
+				withField("decimal", []*float64{}),
+				withRow(
+					withRowValue(time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)),
+					withRowValue(int64(9007199254740993)),
+					withRowValue(1.5),
+				),
+			)),
+		},
+		{
+			name: "V1 array",
+			body: `{"d":[{"datetime":"/Date(1641081600000+0060)/","int64":"1","decimal":"2"}]}`,
+			expected: aDataResponse(withBaseFrame("A",
+				withTimeField("datetime", true),
+				withField("int64", []*int64{}),
+				withField("decimal", []*float64{}),
+				withRow(
+					withRowValue(time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)),
+					withRowValue(int64(1)),
+					withRowValue(2.0),
+				),
+			)),
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			client := clientMock{body: []byte(table.body), statusCode: 200}
+			is := ODataSourceInstance{client: &client}
+			ds := ODataSource{&managerMock{}}
+			query := aDataQuery("A", withQueryModel(
+				func(qm *queryModel) {
+					qm.TimeProperty = &property{Name: "datetime", Type: odata.EdmDateTime}
+				},
+				withProperties(
+					func(p *property) { p.Name, p.Type = "int64", odata.EdmInt64 },
+					func(p *property) { p.Name, p.Type = "decimal", odata.EdmDecimal })))
+
+			// Act
+			resp := ds.query(context.TODO(), &is, query)
+			withoutRequestStats(resp.Frames)
+
+			// Assert
+			assert.Equal(t, table.expected, resp)
+		})
+	}
+}
+
+func TestQueryODataV2Paging(t *testing.T) {
+	// Arrange
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(odata.HeaderDataServiceVersion, "2.0;")
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("$skiptoken") == "" {
+			_, _ = w.Write([]byte(`{"d":{"results":[{"int32":1}],"__next":"Temperatures?$skiptoken=1"}}`))
+		} else {
+			_, _ = w.Write([]byte(`{"d":{"results":[{"int32":2}]}}`))
+		}
+	})
+	is := ODataSourceInstance{client: client}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryModel(withProperties(int32Prop)))
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+
+	// Assert
+	assert.NoError(t, resp.Error)
+	assert.Equal(t, 2, resp.Frames[0].Rows())
+}
@@ -18,7 +18,7 @@ func TestGetClientInstance(t *testing.T) {
 	im := managerMock{}
 	ds := ODataSource{&im}
 
-	is := ODataSourceInstance{client}
+	is := ODataSourceInstance{client: client}
 	im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
 
 	// Act
@@ -47,6 +47,18 @@ func TestNewODataSourceInstanceSuccess(t *testing.T) {
 	require.Equal(t, url, odsic.baseUrl)
 }
 
+func TestNewODataSourceInstanceOAuthPassThru(t *testing.T) {
+	// Act
+	dsi, err := newDatasourceInstance(context.TODO(), backend.DataSourceInstanceSettings{
+		URL:      "http://localhost:8080",
+		JSONData: []byte(`{"oauthPassThru": true}`),
+	})
+
+	// Assert
+	require.NoError(t, err)
+	require.Nil(t, dsi.(*ODataSourceInstance).metadata)
+}
+
 func TestNewODataSourceInstanceInvalidJSON(t *testing.T) {
 	// Act
 	dsi, err := newDatasourceInstance(context.TODO(), backend.DataSourceInstanceSettings{
@@ -86,6 +98,21 @@ func TestCallResource(t *testing.T) {
 			},
 			expRespCode: 200,
 		},
+		{
+			name: "Call metadata refresh, success",
+			req: &backend.CallResourceRequest{
+				Path: "metadata/refresh",
+			},
+			expRespCode: 200,
+		},
+		{
+			name: "Call values without property",
+			req: &backend.CallResourceRequest{
+				Path: "values",
+				Body: []byte(`{"entitySet":"Temperatures"}`),
+			},
+			expRespCode: 400,
+		},
 	}
 
 	for _, table := range tables {
@@ -99,7 +126,7 @@ func TestCallResource(t *testing.T) {
 			im := managerMock{}
 			ds := ODataSource{&im}
 
-			is := ODataSourceInstance{client}
+			is := ODataSourceInstance{client: client}
 			im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
 			crs := callResourceResponseSenderMock{}
 
@@ -117,6 +144,7 @@ func TestCallResourceMetadata(t *testing.T) {
 	tables := []struct {
 		name        string
 		respXml     odata.Edmx
+		respBody    string
 		respErr     error
 		expRespCode int
 		expResponse schema
@@ -143,15 +171,208 @@ func TestCallResourceMetadata(t *testing.T) {
 			expRespCode: 200,
 			expResponse: aSchema(
 				withEntityTypeResource("entity-type-name", "some-namespace",
+					withKeyResource("key-name", "property-name"),
 					withPropertyResource("property-name", "property-type")),
 				withEntitySetResource("entity-set-name", "some-namespace.entity-set-name")),
 		},
+		{
+			name: "V2 metadata response",
+			respBody: `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="1.0" xmlns:edmx="http://schemas.microsoft.com/ado/2007/06/edmx"
+  xmlns:m="http://schemas.microsoft.com/ado/2007/08/dataservices/metadata">
+  <edmx:DataServices m:DataServiceVersion="2.0">
+    <Schema Namespace="NS" xmlns="http://schemas.microsoft.com/ado/2008/09/edm">
+      <EntityType Name="Order">
+        <Key><PropertyRef Name="Id"/></Key>
+        <Property Name="Id" Type="Edm.Int32" Nullable="false"/>
+        <Property Name="CreatedAt" Type="Edm.DateTime" m:FC_KeepInContent="false"/>
+      </EntityType>
+      <EntityContainer Name="Container" m:IsDefaultEntityContainer="true">
+        <EntitySet Name="Orders" EntityType="NS.Order"/>
+      </EntityContainer>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>`,
+			expRespCode: 200,
+			expResponse: aSchema(
+				withSchemaVersion("2.0"),
+				withEntityTypeResource("Order", "NS",
+					withKeyResource("Id"),
+					withPropertyResource("Id", "Edm.Int32"),
+					withPropertyResource("CreatedAt", "Edm.DateTime")),
+				withEntitySetResource("Orders", "NS.Order")),
+		},
+		{
+			name: "Complex types",
+			respBody: `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="4.0" xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx">
+  <edmx:DataServices>
+    <Schema Namespace="NS" xmlns="http://docs.oasis-open.org/odata/ns/edm">
+      <ComplexType Name="Address">
+        <Property Name="City" Type="Edm.String"/>
+        <Property Name="Location" Type="NS.Location"/>
+      </ComplexType>
+      <ComplexType Name="Location">
+        <Property Name="Latitude" Type="Edm.Double"/>
+      </ComplexType>
+      <EntityType Name="Customer">
+        <Property Name="Id" Type="Edm.Int32"/>
+        <Property Name="Address" Type="NS.Address"/>
+      </EntityType>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>`,
+			expRespCode: 200,
+			expResponse: aSchema(
+				withComplexTypeResource("Address", "NS", property{Name: "City", Type: "Edm.String"},
+					property{Name: "Location", Type: "NS.Location"}),
+				withComplexTypeResource("Location", "NS", property{Name: "Latitude", Type: "Edm.Double"}),
+				withEntityTypeResource("Customer", "NS",
+					withPropertyResource("Id", "Edm.Int32"),
+					withPropertyResource("Address", "NS.Address"))),
+		},
+		{
+			name: "Enum types and type definitions",
+			respBody: `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="4.0" xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx">
+  <edmx:DataServices>
+    <Schema Namespace="NS" xmlns="http://docs.oasis-open.org/odata/ns/edm">
+      <EnumType Name="Color" UnderlyingType="Edm.Byte" IsFlags="true">
+        <Member Name="Red" Value="1"/>
+        <Member Name="Green" Value="2"/>
+      </EnumType>
+      <EnumType Name="Size">
+        <Member Name="Small"/>
+        <Member Name="Large"/>
+      </EnumType>
+      <TypeDefinition Name="Code" UnderlyingType="Edm.String"/>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>`,
+			expRespCode: 200,
+			expResponse: aSchema(func(s *schema) {
+				s.EnumTypes["NS.Color"] = enumType{Name: "Color", QualifiedName: "NS.Color",
+					UnderlyingType: "Edm.Byte", IsFlags: true,
+					Members: []enumMember{{Name: "Red", Value: 1}, {Name: "Green", Value: 2}}}
+				s.EnumTypes["NS.Size"] = enumType{Name: "Size", QualifiedName: "NS.Size",
+					UnderlyingType: "Edm.Int32", Members: []enumMember{{Name: "Small"}, {Name: "Large", Value: 1}}}
+				s.TypeDefinitions["NS.Code"] = "Edm.String"
+			}),
+		},
+		{
+			name: "Inheritance",
+			respBody: `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="4.0" xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx">
+  <edmx:DataServices>
+    <Schema Namespace="Base" xmlns="http://docs.oasis-open.org/odata/ns/edm">
+      <EntityType Name="Event" Abstract="true">
+        <Key><PropertyRef Name="Id"/></Key>
+        <Property Name="Id" Type="Edm.Int32"/>
+        <Property Name="Time" Type="Edm.DateTimeOffset"/>
+        <NavigationProperty Name="Source" Type="Base.Source"/>
+      </EntityType>
+    </Schema>
+    <Schema Namespace="NS" xmlns="http://docs.oasis-open.org/odata/ns/edm">
+      <EntityType Name="Order" BaseType="Base.Event">
+        <Key><PropertyRef Name="Number"/></Key>
+        <Property Name="Number" Type="Edm.String"/>
+        <Property Name="Amount" Type="Edm.Double"/>
+      </EntityType>
+      <EntityType Name="SpecialOrder" BaseType="NS.Order">
+        <Property Name="Priority" Type="Edm.Int32"/>
+      </EntityType>
+      <EntityContainer Name="Container">
+        <EntitySet Name="Orders" EntityType="NS.Order"/>
+      </EntityContainer>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>`,
+			expRespCode: 200,
+			expResponse: aSchema(
+				withEntityTypeResource("Event", "Base",
+					func(et *entityType) { et.Abstract = true },
+					withKeyResource("Id"),
+					withPropertyResource("Id", "Edm.Int32"),
+					withPropertyResource("Time", "Edm.DateTimeOffset"),
+					withNavigationPropertyResource("Source", "Base.Source", false)),
+				withEntityTypeResource("Order", "NS",
+					func(et *entityType) { et.BaseType = "Base.Event" },
+					withKeyResource("Number"),
+					withPropertyResource("Id", "Edm.Int32"),
+					withPropertyResource("Time", "Edm.DateTimeOffset"),
+					withNavigationPropertyResource("Source", "Base.Source", false),
+					withPropertyResource("Number", "Edm.String"),
+					withPropertyResource("Amount", "Edm.Double")),
+				withEntityTypeResource("SpecialOrder", "NS",
+					func(et *entityType) { et.BaseType = "NS.Order" },
+					withKeyResource("Number"),
+					withPropertyResource("Id", "Edm.Int32"),
+					withPropertyResource("Time", "Edm.DateTimeOffset"),
+					withNavigationPropertyResource("Source", "Base.Source", false),
+					withPropertyResource("Number", "Edm.String"),
+					withPropertyResource("Amount", "Edm.Double"),
+					withPropertyResource("Priority", "Edm.Int32")),
+				withEntitySetResource("Orders", "NS.Order"),
+				withEntitySetResource("Orders/NS.SpecialOrder", "NS.SpecialOrder")),
+		},
+		{
+			name: "V4 navigation properties",
+			respXml: anOdataEdmx("4.0",
+				withDataService(
+					withSchema("NS",
+						withEntityType("Order",
+							withProperty("Id", "Edm.Int32"),
+							withNavigationProperty("Customer", "NS.Customer"),
+							withNavigationProperty("Items", "Collection(NS.Item)"))))),
+			expRespCode: 200,
+			expResponse: aSchema(
+				withEntityTypeResource("Order", "NS",
+					withPropertyResource("Id", "Edm.Int32"),
+					withNavigationPropertyResource("Customer", "NS.Customer", false),
+					withNavigationPropertyResource("Items", "NS.Item", true))),
+		},
+		{
+			name: "V2 navigation properties",
+			respBody: `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="1.0" xmlns:edmx="http://schemas.microsoft.com/ado/2007/06/edmx"
+  xmlns:m="http://schemas.microsoft.com/ado/2007/08/dataservices/metadata">
+  <edmx:DataServices m:DataServiceVersion="2.0">
+    <Schema Namespace="NS" xmlns="http://schemas.microsoft.com/ado/2008/09/edm">
+      <EntityType Name="Order">
+        <Key><PropertyRef Name="Id"/></Key>
+        <Property Name="Id" Type="Edm.Int32" Nullable="false"/>
+        <NavigationProperty Name="Customer" Relationship="NS.Order_Customer" FromRole="Order" ToRole="Customer"/>
+        <NavigationProperty Name="Items" Relationship="NS.Order_Items" FromRole="Order" ToRole="Items"/>
+      </EntityType>
+      <Association Name="Order_Customer">
+        <End Type="NS.Order" Multiplicity="*" Role="Order"/>
+        <End Type="NS.Customer" Multiplicity="1" Role="Customer"/>
+      </Association>
+      <Association Name="Order_Items">
+        <End Type="NS.Order" Multiplicity="1" Role="Order"/>
+        <End Type="NS.Item" Multiplicity="*" Role="Items"/>
+      </Association>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>`,
+			expRespCode: 200,
+			expResponse: aSchema(
+				withSchemaVersion("2.0"),
+				withEntityTypeResource("Order", "NS",
+					withKeyResource("Id"),
+					withPropertyResource("Id", "Edm.Int32"),
+					withNavigationPropertyResource("Customer", "NS.Customer", false),
+					withNavigationPropertyResource("Items", "NS.Item", true))),
+		},
 	}
 
 	for _, table := range tables {
 		t.Run(table.name, func(t *testing.T) {
 			// Arrange
 			body, _ := xml.Marshal(table.respXml)
+			if table.respBody != "" {
+				body = []byte(table.respBody)
+			}
 			client := &clientMock{
 				body:       body,
 				err:        table.respErr,
@@ -160,12 +381,12 @@ func TestCallResourceMetadata(t *testing.T) {
 			im := managerMock{}
 			ds := ODataSource{&im}
 
-			is := ODataSourceInstance{client}
+			is := ODataSourceInstance{client: client}
 			im.On("Get", context.TODO(), mock.Anything).Return(&is, nil)
 			crs := callResourceResponseSenderMock{}
 
 			// Act
-			err := ds.getMetadata(context.TODO(), &backend.CallResourceRequest{Path: "metadata"}, &crs)
+			err := ds.getMetadata(context.TODO(), &backend.CallResourceRequest{Path: "metadata"}, &crs, false)
 
 			// Assert
 			require.NoError(t, err)
@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+)
+
+// newEnumType maps an enum type of the metadata. Members without value are numbered by position.
+func newEnumType(namespace string, et *odata.EnumType) enumType {
+	underlyingType := et.UnderlyingType
+	if underlyingType == "" {
+		underlyingType = odata.EdmInt32
+	}
+	result := enumType{
+		Name:           et.Name,
+		QualifiedName:  namespace + "." + et.Name,
+		UnderlyingType: underlyingType,
+		IsFlags:        et.IsFlags,
+		Members:        []enumMember{},
+	}
+	for i, m := range et.Members {
+		value, err := strconv.ParseInt(m.Value, 10, 64)
+		if err != nil {
+			value = int64(i)
+		}
+		result.Members = append(result.Members, enumMember{Name: m.Name, Value: value})
+	}
+	return result
+}
+
+// number returns the numeric value of an enum value. Services return member names, combined flags separated by
+// commas, e.g. "Red,Blue", or the numeric value itself. Unknown members result in nil.
+func (e *enumType) number(value interface{}) *int64 {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	default:
+		return nil
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return &n
+	}
+	var result int64
+	for _, name := range strings.Split(text, ",") {
+		found := false
+		for _, m := range e.Members {
+			if m.Name == strings.TrimSpace(name) {
+				result |= m.Value
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return &result
+}
+
+// resolveEnums marks the enum properties among the columns, which are then read as their numeric values. The enum
+// types are taken from the cached metadata of the service.
+func (ds *ODataSource) resolveEnums(ctx context.Context, instance *ODataSourceInstance,
+	columns []property) error {
+	metadata, err := instance.metadata.get(ctx, instance.client, false)
+	if err != nil {
+		return err
+	}
+	for i, column := range columns {
+		if enum, ok := metadata.EnumTypes[column.Type]; ok {
+			columns[i].Type = odata.EdmInt64
+			columns[i].enum = &enum
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func colorEnum() enumType {
+	return enumType{
+		Name:           "Color",
+		QualifiedName:  "NS.Color",
+		UnderlyingType: odata.EdmInt32,
+		IsFlags:        true,
+		Members:        []enumMember{{Name: "Red", Value: 1}, {Name: "Green", Value: 2}, {Name: "Blue", Value: 4}},
+	}
+}
+
+func TestEnumNumber(t *testing.T) {
+	tables := []struct {
+		name     string
+		value    interface{}
+		expected *int64
+	}{
+		{name: "Member", value: "Green", expected: pointerTo(int64(2))},
+		{name: "Flags", value: "Red, Blue", expected: pointerTo(int64(5))},
+		{name: "Numeric string", value: "6", expected: pointerTo(int64(6))},
+		{name: "Number", value: json.Number("4"), expected: pointerTo(int64(4))},
+		{name: "Unknown member", value: "Yellow"},
+		{name: "Null", value: nil},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			enum := colorEnum()
+
+			// Act
+			result := enum.number(table.value)
+
+			// Assert
+			assert.Equal(t, table.expected, result)
+		})
+	}
+}
+
+func TestQueryNumericEnums(t *testing.T) {
+	tables := []struct {
+		name         string
+		numericEnums bool
+		expected     func(*data.Frame)
+	}{
+		{
+			name:     "Member names",
+			expected: withField("color", []*string{pointerTo("Red,Blue")}),
+		},
+		{
+			name:         "Numeric values",
+			numericEnums: true,
+			expected:     withField("color", []*int64{pointerTo(int64(5))}),
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			metadata := aSchema(func(s *schema) { s.EnumTypes["NS.Color"] = colorEnum() })
+			body, _ := json.Marshal(anOdataResponse(withEntity(withProp("color", "Red,Blue"))))
+			is := ODataSourceInstance{
+				client:   &clientMock{body: body, statusCode: 200},
+				metadata: &metadataCache{ttl: time.Hour, schema: &metadata, expires: time.Now().Add(time.Hour)},
+			}
+			ds := ODataSource{&managerMock{}}
+			query := aDataQuery("A", withQueryModel(
+				withProperties(func(p *property) { p.Name, p.Type = "color", "NS.Color" }),
+				func(qm *queryModel) { qm.NumericEnums = table.numericEnums }))
+
+			// Act
+			resp := ds.query(context.TODO(), &is, query)
+
+			// Assert
+			withoutRequestStats(resp.Frames)
+			assert.NoError(t, resp.Error)
+			assert.Equal(t, aDataResponse(withBaseFrame("A", table.expected)), resp)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Upper bound of the error payload read from a failed response
+const maxErrorBodySize = 64 * 1024
+
+// responseError is a request the service answered with a status other than 200 OK
+type responseError struct {
+	operation  string
+	statusCode int
+	// odataError is the error payload of the response, nil if the service did not send one
+	odataError *odata.Error
+}
+
+func (e *responseError) Error() string {
+	message := fmt.Sprintf("%s failed with status code %d", e.operation, e.statusCode)
+	if e.odataError != nil {
+		message += ": " + e.odataError.Error()
+	}
+	return message
+}
+
+// newResponseError reads the error payload of a failed response. The error is attributed to the service.
+func newResponseError(operation string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return backend.DownstreamError(&responseError{
+		operation:  operation,
+		statusCode: resp.StatusCode,
+		odataError: odata.ParseError(body),
+	})
+}
+
+// setErrorStatus sets status and error source of a failed query from the response of the service
+func setErrorStatus(response *backend.DataResponse) {
+	var respErr *responseError
+	switch {
+	case response.Error == nil:
+		return
+	case errors.As(response.Error, &respErr):
+		response.Status = statusFromCode(respErr.statusCode)
+		response.ErrorSource = backend.ErrorSourceDownstream
+	case isTimeout(response.Error):
+		response.Status = backend.StatusTimeout
+		response.ErrorSource = backend.ErrorSourceDownstream
+	case backend.IsDownstreamHTTPError(response.Error):
+		response.Status = backend.StatusBadGateway
+		response.ErrorSource = backend.ErrorSourceDownstream
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// statusFromCode maps the HTTP status code of the service to the status of the query
+func statusFromCode(code int) backend.Status {
+	switch code {
+	case http.StatusBadRequest:
+		return backend.StatusBadRequest
+	case http.StatusUnauthorized:
+		return backend.StatusUnauthorized
+	case http.StatusForbidden:
+		return backend.StatusForbidden
+	case http.StatusNotFound:
+		return backend.StatusNotFound
+	case http.StatusTooManyRequests:
+		return backend.StatusTooManyRequests
+	case http.StatusNotImplemented:
+		return backend.StatusNotImplemented
+	case http.StatusGatewayTimeout:
+		return backend.StatusTimeout
+	}
+	if code >= http.StatusInternalServerError {
+		return backend.StatusBadGateway
+	}
+	return backend.StatusBadRequest
+}
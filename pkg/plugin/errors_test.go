@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseError(t *testing.T) {
+	tables := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name: "V4 JSON",
+			body: `{"error":{"code":"InvalidFilter","message":"Property 'foo' does not exist","target":"$filter",` +
+				`"details":[{"code":"NotFound","message":"Type 'Temperature' has no property 'foo'"}]}}`,
+			expected: "InvalidFilter: Property 'foo' does not exist [$filter] (Type 'Temperature' has no property 'foo')",
+		},
+		{
+			name:     "V2 JSON with localized message",
+			body:     `{"error":{"code":"SY/530","message":{"lang":"en","value":"Resource not found"}}}`,
+			expected: "SY/530: Resource not found",
+		},
+		{
+			name:     "V3 JSON light",
+			body:     `{"odata.error":{"code":"","message":{"lang":"en-US","value":"Invalid $top value"}}}`,
+			expected: "Invalid $top value",
+		},
+		{
+			name: "SAP Gateway error details",
+			body: `{"error":{"code":"/IWBEP/CM_MGW_RT/020","message":{"lang":"en","value":"Filter invalid"},` +
+				`"innererror":{"errordetails":[{"code":"/IWBEP/CM_MGW_RT/020","message":"Filter invalid"},` +
+				`{"code":"ZMSG/001","message":"Property Plant is not filterable"}]}}}`,
+			expected: "/IWBEP/CM_MGW_RT/020: Filter invalid (Property Plant is not filterable)",
+		},
+		{
+			name: "XML",
+			body: `<?xml version="1.0" encoding="utf-8"?>` +
+				`<m:error xmlns:m="http://schemas.microsoft.com/ado/2007/08/dataservices/metadata">` +
+				`<m:code>005056A509B11EE1B9A8FEC11C21578E</m:code>` +
+				`<m:message xml:lang="en">Invalid parametertype used at function 'eq'</m:message></m:error>`,
+			expected: "005056A509B11EE1B9A8FEC11C21578E: Invalid parametertype used at function 'eq'",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			err := odata.ParseError([]byte(table.body))
+
+			// Assert
+			if assert.NotNil(t, err) {
+				assert.Equal(t, table.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestParseErrorWithoutPayload(t *testing.T) {
+	for _, body := range []string{"", "Service Unavailable", `{"value":[]}`, "<html><body>Bad Gateway</body></html>"} {
+		assert.Nil(t, odata.ParseError([]byte(body)), body)
+	}
+}
+
+func TestQueryErrorResponse(t *testing.T) {
+	tables := []struct {
+		name          string
+		statusCode    int
+		body          string
+		expectedError string
+		expected      backend.Status
+	}{
+		{
+			name:       "OData error",
+			statusCode: http.StatusBadRequest,
+			body:       `{"error":{"code":"InvalidFilter","message":"Property 'foo' does not exist"}}`,
+			expectedError: "get failed with status code 400: InvalidFilter: " +
+				"Property 'foo' does not exist",
+			expected: backend.StatusBadRequest,
+		},
+		{
+			name:          "Unauthorized",
+			statusCode:    http.StatusUnauthorized,
+			expectedError: "get failed with status code 401",
+			expected:      backend.StatusUnauthorized,
+		},
+		{
+			name:          "Not implemented",
+			statusCode:    http.StatusNotImplemented,
+			body:          "not supported",
+			expectedError: "get failed with status code 501",
+			expected:      backend.StatusNotImplemented,
+		},
+		{
+			name:          "Server error",
+			statusCode:    http.StatusInternalServerError,
+			body:          `<error><code>500</code><message>Internal error</message></error>`,
+			expectedError: "get failed with status code 500: 500: Internal error",
+			expected:      backend.StatusBadGateway,
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(table.statusCode)
+				_, _ = w.Write([]byte(table.body))
+			})
+			is := ODataSourceInstance{client: client}
+			ds := ODataSource{&managerMock{}}
+			query := aDataQuery("A", withQueryModel(withTimeProperty("time")))
+
+			// Act
+			resp := ds.query(context.TODO(), &is, query)
+
+			// Assert
+			assert.EqualError(t, resp.Error, table.expectedError)
+			assert.Equal(t, table.expected, resp.Status)
+			assert.Equal(t, backend.ErrorSourceDownstream, resp.ErrorSource)
+		})
+	}
+}
+
+func TestQueryErrorResponseNotFromService(t *testing.T) {
+	// Arrange
+	is := ODataSourceInstance{client: GetOC("*", nil)}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryType(queryTypeAnnotations), withQueryModel())
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+
+	// Assert
+	assert.Error(t, resp.Error)
+	assert.Equal(t, backend.Status(0), resp.Status)
+	assert.Equal(t, backend.ErrorSource(""), resp.ErrorSource)
+}
@@ -0,0 +1,290 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+)
+
+const (
+	filterAnd = "and"
+	filterOr  = "or"
+
+	operatorContains   = "contains"
+	operatorStartsWith = "startswith"
+	operatorEndsWith   = "endswith"
+	operatorIn         = "in"
+	operatorHas        = "has"
+	// operatorIsNull and operatorIsNotNull compare with null, which is also a valid value of string properties
+	operatorIsNull    = "isnull"
+	operatorIsNotNull = "isnotnull"
+)
+
+// combineFilters combines the flat filter conditions, which include the time range, and the filter tree with "and"
+func combineFilters(filterConditions []filterCondition, filter *filterNode, version string) (string, error) {
+	conditions, err := mapFilter(filterConditions, version)
+	if err != nil || filter == nil {
+		return conditions, err
+	}
+	tree, compound, err := mapFilterNode(*filter, version)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case tree == "":
+		return conditions, nil
+	case conditions == "":
+		return tree, nil
+	case compound:
+		return conditions + " and (" + tree + ")", nil
+	default:
+		return conditions + " and " + tree, nil
+	}
+}
+
+// mapFilter joins the flat filter conditions with "and"
+func mapFilter(filterConditions []filterCondition, version string) (string, error) {
+	var terms []string
+	for _, condition := range filterConditions {
+		term, err := mapCondition(condition, version)
+		if err != nil {
+			return "", err
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " and "), nil
+}
+
+// mapFilterNode serializes a filter tree, e.g. "(a eq 1 or b eq 2) and not (c eq 3)". The second return value reports
+// whether the expression consists of several terms and needs parentheses when embedded in another expression.
+// Empty groups and conditions without property, e.g. just added in the query editor, are skipped.
+func mapFilterNode(node filterNode, version string) (string, bool, error) {
+	var expression string
+	compound := false
+	if node.Condition != nil && node.Condition.Property.Name == "" {
+		return "", false, nil
+	}
+	if node.Condition != nil {
+		term, err := mapCondition(*node.Condition, version)
+		if err != nil {
+			return "", false, err
+		}
+		expression = term
+	} else {
+		var operator string
+		switch strings.ToLower(node.Operator) {
+		case "", filterAnd:
+			operator = " " + filterAnd + " "
+		case filterOr:
+			operator = " " + filterOr + " "
+		default:
+			return "", false, fmt.Errorf("unsupported filter group operator: %s", node.Operator)
+		}
+		var terms []string
+		for _, child := range node.Children {
+			term, childCompound, err := mapFilterNode(child, version)
+			if err != nil {
+				return "", false, err
+			}
+			if term == "" {
+				continue
+			}
+			if childCompound {
+				term = "(" + term + ")"
+			}
+			terms = append(terms, term)
+		}
+		expression = strings.Join(terms, operator)
+		compound = len(terms) > 1
+	}
+	if node.Not && expression != "" {
+		return "not (" + expression + ")", false, nil
+	}
+	return expression, compound, nil
+}
+
+// mapCondition serializes a single filter condition. Comparison operators like "eq" and "has" are infix operators,
+// string operators are function calls, e.g. contains(Name,'abc') or substringof('abc',Name) eq true on V2 services.
+// "in" is expanded to "or"-ed comparisons on services older than 4.01, "isnull" and "isnotnull" compare with null and
+// take no value. Values are formatted as literals of the property type, invalid values and unknown operators are
+// reported as error.
+func mapCondition(condition filterCondition, version string) (string, error) {
+	operator := strings.ToLower(condition.Operator)
+	name := condition.Property.path()
+	switch operator {
+	case operatorIsNull:
+		return fmt.Sprintf("%s eq %s", name, odata.Null), nil
+	case operatorIsNotNull:
+		return fmt.Sprintf("%s ne %s", name, odata.Null), nil
+	}
+	if len(condition.Values) > 0 && operator != operatorIn {
+		return mapMultiValueCondition(condition, version)
+	}
+	caseInsensitive := condition.CaseInsensitive && condition.Property.Type == odata.EdmString
+	literal := func(value string) (string, error) {
+		result, err := condition.literal(value, version)
+		if err != nil {
+			return "", fmt.Errorf("filter on %s: %w", name, err)
+		}
+		if caseInsensitive {
+			return fmt.Sprintf("tolower(%s)", result), nil
+		}
+		return result, nil
+	}
+	if caseInsensitive {
+		name = fmt.Sprintf("tolower(%s)", name)
+	}
+
+	switch operator {
+	case operatorContains, operatorStartsWith, operatorEndsWith:
+		value, err := literal(condition.Value)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case operator == operatorContains && odata.IsV2(version):
+			return fmt.Sprintf("substringof(%s,%s) eq true", value, name), nil
+		case odata.IsV2(version):
+			return fmt.Sprintf("%s(%s,%s) eq true", operator, name, value), nil
+		default:
+			return fmt.Sprintf("%s(%s,%s)", operator, name, value), nil
+		}
+	case operatorIn:
+		var literals []string
+		for _, v := range condition.values() {
+			value, err := literal(v)
+			if err != nil {
+				return "", err
+			}
+			literals = append(literals, value)
+		}
+		switch {
+		case len(literals) == 0:
+			// Nothing is in an empty list
+			return "false", nil
+		case odata.IsV401(version):
+			return fmt.Sprintf("%s in (%s)", name, strings.Join(literals, ",")), nil
+		case len(literals) == 1:
+			return fmt.Sprintf("%s eq %s", name, literals[0]), nil
+		default:
+			var terms []string
+			for _, l := range literals {
+				terms = append(terms, fmt.Sprintf("%s eq %s", name, l))
+			}
+			return "(" + strings.Join(terms, " or ") + ")", nil
+		}
+	case operatorHas:
+		// The value is an enum literal like NS.Color'Red', which is never lowercased
+		value, err := condition.literal(condition.Value, version)
+		if err != nil {
+			return "", fmt.Errorf("filter on %s: %w", name, err)
+		}
+		return fmt.Sprintf("%s has %s", name, value), nil
+	case "eq", "ne", "gt", "ge", "lt", "le":
+		value, err := literal(condition.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", name, operator, value), nil
+	default:
+		return "", fmt.Errorf("unsupported filter operator: %s", condition.Operator)
+	}
+}
+
+// mapMultiValueCondition applies the operator of the condition to each of its values. "eq" is mapped like "in",
+// "ne" requires all comparisons to hold and other operators any of them.
+func mapMultiValueCondition(condition filterCondition, version string) (string, error) {
+	operator := strings.ToLower(condition.Operator)
+	if operator == "eq" {
+		condition.Operator = operatorIn
+		return mapCondition(condition, version)
+	}
+	join := " " + filterOr + " "
+	if operator == "ne" {
+		join = " " + filterAnd + " "
+	}
+	var terms []string
+	for _, value := range condition.Values {
+		single := condition
+		single.Value, single.Values = value, nil
+		term, err := mapCondition(single, version)
+		if err != nil {
+			return "", err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return "(" + strings.Join(terms, join) + ")", nil
+}
+
+// values returns the values of a list condition
+func (condition filterCondition) values() []string {
+	if len(condition.Values) > 0 {
+		return condition.Values
+	}
+	if condition.Value == "" {
+		return nil
+	}
+	var values []string
+	for _, value := range strings.Split(condition.Value, ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+	return values
+}
+
+// literal formats a value of the condition as literal of the property type, values of enum properties as enum literals
+func (condition filterCondition) literal(value string, version string) (string, error) {
+	if condition.Property.enum != nil {
+		return odata.FormatEnumLiteral(condition.Property.Type, value)
+	}
+	return odata.FormatLiteral(condition.Property.Type, value, version)
+}
+
+// conditions returns the conditions of the node and its descendants
+func (node *filterNode) conditions() []*filterCondition {
+	if node == nil {
+		return nil
+	}
+	var conditions []*filterCondition
+	if node.Condition != nil {
+		conditions = append(conditions, node.Condition)
+	}
+	for i := range node.Children {
+		conditions = append(conditions, node.Children[i].conditions()...)
+	}
+	return conditions
+}
+
+// resolveFilterTypes looks up the property types of the conditions which are not Edm types in the cached metadata.
+// Type definitions are replaced by their underlying type and enum properties are marked, other types are left as they
+// are. The metadata is only loaded if there are such conditions.
+func (ds *ODataSource) resolveFilterTypes(ctx context.Context, instance *ODataSourceInstance,
+	filterConditions []filterCondition, filter *filterNode) error {
+	var conditions []*filterCondition
+	for i := range filterConditions {
+		conditions = append(conditions, &filterConditions[i])
+	}
+	conditions = slices.DeleteFunc(append(conditions, filter.conditions()...), func(c *filterCondition) bool {
+		return c.Property.Type == "" || strings.HasPrefix(c.Property.Type, "Edm.")
+	})
+	if len(conditions) == 0 {
+		return nil
+	}
+	metadata, err := instance.metadata.get(ctx, instance.client, false)
+	if err != nil {
+		return err
+	}
+	for _, condition := range conditions {
+		if underlyingType, ok := metadata.TypeDefinitions[condition.Property.Type]; ok {
+			condition.Property.Type = underlyingType
+		} else if enum, ok := metadata.EnumTypes[condition.Property.Type]; ok {
+			condition.Property.enum = &enum
+		}
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCombineFilters(t *testing.T) {
+	tables := []struct {
+		name             string
+		filterConditions []filterCondition
+		filter           *filterNode
+		expected         string
+	}{
+		{
+			name:             "Flat conditions only",
+			filterConditions: someFilterConditions(int32Eq5, withFilterCondition(stringProp, "eq", "Hello")),
+			expected:         "int32 eq 5 and string eq 'Hello'",
+		},
+		{
+			name:     "Or group only",
+			filter:   anOrGroup(aConditionNode(int32Eq5), aConditionNode(withFilterCondition(stringProp, "eq", "A"))),
+			expected: "int32 eq 5 or string eq 'A'",
+		},
+		{
+			name:             "Flat conditions and or group",
+			filterConditions: someFilterConditions(withFilterCondition(timeProp, "ge", "2022-04-21T12:30:50Z")),
+			filter:           anOrGroup(aConditionNode(int32Eq5), aConditionNode(withFilterCondition(stringProp, "eq", "A"))),
+			expected:         "time ge 2022-04-21T12:30:50Z and (int32 eq 5 or string eq 'A')",
+		},
+		{
+			name: "Nested groups",
+			filter: anAndGroup(
+				anOrGroup(aConditionNode(int32Eq5), aConditionNode(withFilterCondition(int32Prop, "gt", "10"))),
+				negated(anOrGroup(
+					aConditionNode(withFilterCondition(stringProp, "eq", "A")),
+					aConditionNode(withFilterCondition(stringProp, "eq", "B")))),
+				aConditionNode(withFilterCondition(booleanProp, "eq", "true"))),
+			expected: "(int32 eq 5 or int32 gt 10) and not (string eq 'A' or string eq 'B') and boolean eq true",
+		},
+		{
+			name:     "Negated condition",
+			filter:   negated(aConditionNode(int32Eq5)),
+			expected: "not (int32 eq 5)",
+		},
+		{
+			name:     "Single child group",
+			filter:   anAndGroup(anOrGroup(aConditionNode(int32Eq5))),
+			expected: "int32 eq 5",
+		},
+		{
+			name:             "Empty groups",
+			filterConditions: someFilterConditions(int32Eq5),
+			filter:           anOrGroup(anAndGroup(), negated(anOrGroup())),
+			expected:         "int32 eq 5",
+		},
+		{
+			name:     "Conditions without property",
+			filter:   anOrGroup(aConditionNode(int32Eq5), negated(aConditionNode())),
+			expected: "int32 eq 5",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			filter, err := combineFilters(table.filterConditions, table.filter, odata.V4)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, table.expected, filter)
+		})
+	}
+}
+
+func TestMapCondition(t *testing.T) {
+	tables := []struct {
+		name          string
+		condition     *filterCondition
+		version       string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:      "Contains",
+			condition: aFilterCondition(withFilterCondition(stringProp, "contains", "abc")),
+			version:   odata.V4,
+			expected:  "contains(string,'abc')",
+		},
+		{
+			name:      "Contains V2",
+			condition: aFilterCondition(withFilterCondition(stringProp, "contains", "abc")),
+			version:   odata.V2,
+			expected:  "substringof('abc',string) eq true",
+		},
+		{
+			name:      "Starts with",
+			condition: aFilterCondition(withFilterCondition(stringProp, "startswith", "abc")),
+			version:   odata.V4,
+			expected:  "startswith(string,'abc')",
+		},
+		{
+			name:      "Ends with V2",
+			condition: aFilterCondition(withFilterCondition(stringProp, "endswith", "abc")),
+			version:   odata.V2,
+			expected:  "endswith(string,'abc') eq true",
+		},
+		{
+			name:      "Case-insensitive contains",
+			condition: aFilterCondition(withFilterCondition(stringProp, "contains", "ABC"), caseInsensitive),
+			version:   odata.V4,
+			expected:  "contains(tolower(string),tolower('ABC'))",
+		},
+		{
+			name:      "Case-insensitive eq",
+			condition: aFilterCondition(withFilterCondition(stringProp, "eq", "ABC"), caseInsensitive),
+			version:   odata.V4,
+			expected:  "tolower(string) eq tolower('ABC')",
+		},
+		{
+			name:      "Case-insensitive ignored for numbers",
+			condition: aFilterCondition(withFilterCondition(int32Prop, "eq", "5"), caseInsensitive),
+			version:   odata.V4,
+			expected:  "int32 eq 5",
+		},
+		{
+			name:      "Complex type property",
+			condition: aFilterCondition(withFilterCondition(cityProp, "eq", "Berlin"), caseInsensitive),
+			version:   odata.V4,
+			expected:  "tolower(Address/City) eq tolower('Berlin')",
+		},
+		{
+			name:      "In V4.01",
+			condition: aFilterCondition(withFilterCondition(stringProp, "in", "A, B")),
+			version:   "4.01",
+			expected:  "string in ('A','B')",
+		},
+		{
+			name:      "In V4.0",
+			condition: aFilterCondition(withFilterCondition(stringProp, "in", "A, B")),
+			version:   odata.V4,
+			expected:  "(string eq 'A' or string eq 'B')",
+		},
+		{
+			name:      "In with values",
+			condition: aFilterCondition(withFilterCondition(int32Prop, "in", ""), withValues("1", "2")),
+			version:   "4.01",
+			expected:  "int32 in (1,2)",
+		},
+		{
+			name:      "In with single value",
+			condition: aFilterCondition(withFilterCondition(stringProp, "in", "A")),
+			version:   odata.V2,
+			expected:  "string eq 'A'",
+		},
+		{
+			name:      "In with empty list",
+			condition: aFilterCondition(withFilterCondition(stringProp, "in", "")),
+			version:   odata.V4,
+			expected:  "false",
+		},
+		{
+			name: "Has",
+			condition: aFilterCondition(withFilterCondition(func(p *property) {
+				p.Name, p.Type, p.enum = "color", "NS.Color", pointerTo(colorEnum())
+			}, "has", "NS.Color'Red'")),
+			version:  odata.V4,
+			expected: "color has NS.Color'Red'",
+		},
+		{
+			name: "Has with unqualified member",
+			condition: aFilterCondition(withFilterCondition(func(p *property) {
+				p.Name, p.Type, p.enum = "color", "NS.Color", pointerTo(colorEnum())
+			}, "has", "Red")),
+			version:  odata.V4,
+			expected: "color has NS.Color'Red'",
+		},
+		{
+			name: "Enum in V4.01",
+			condition: aFilterCondition(withFilterCondition(func(p *property) {
+				p.Name, p.Type, p.enum = "color", "NS.Color", pointerTo(colorEnum())
+			}, "in", "Red, Green")),
+			version:  "4.01",
+			expected: "color in (NS.Color'Red',NS.Color'Green')",
+		},
+		{
+			name: "Type definition",
+			condition: aFilterCondition(withFilterCondition(func(p *property) {
+				p.Name, p.Type = "code", "NS.Code"
+			}, "eq", "A1")),
+			version:  odata.V4,
+			expected: "code eq A1",
+		},
+		{
+			name: "Type definition with invalid token",
+			condition: aFilterCondition(withFilterCondition(func(p *property) {
+				p.Name, p.Type = "code", "NS.Code"
+			}, "eq", "A1 or true")),
+			version:       odata.V4,
+			expectedError: `invalid NS.Code value: "A1 or true"`,
+		},
+		{
+			name:      "String null",
+			condition: aFilterCondition(withFilterCondition(stringProp, "eq", "null")),
+			version:   odata.V4,
+			expected:  "string eq 'null'",
+		},
+		{
+			name:      "String is null",
+			condition: aFilterCondition(withFilterCondition(stringProp, "isnull", ""), caseInsensitive),
+			version:   odata.V4,
+			expected:  "string eq null",
+		},
+		{
+			name:      "Is not null",
+			condition: aFilterCondition(withFilterCondition(cityProp, "isnotnull", "ignored")),
+			version:   odata.V2,
+			expected:  "Address/City ne null",
+		},
+		{
+			name:      "Quotes are escaped",
+			condition: aFilterCondition(withFilterCondition(stringProp, "eq", "O'Neil")),
+			version:   odata.V4,
+			expected:  "string eq 'O''Neil'",
+		},
+		{
+			name:      "Null",
+			condition: aFilterCondition(withFilterCondition(int32Prop, "ne", "null")),
+			version:   odata.V4,
+			expected:  "int32 ne null",
+		},
+		{
+			name:      "Int64 V2",
+			condition: aFilterCondition(withFilterCondition(int64Prop, "gt", "9007199254740993")),
+			version:   odata.V2,
+			expected:  "int64 gt 9007199254740993L",
+		},
+		{
+			name:      "Decimal V2",
+			condition: aFilterCondition(withFilterCondition(decimalProp, "ge", "12.5")),
+			version:   odata.V2,
+			expected:  "decimal ge 12.5M",
+		},
+		{
+			name:      "Date",
+			condition: aFilterCondition(withFilterCondition(dateProp, "le", "2022-04-21T23:30:50+02:00")),
+			version:   odata.V4,
+			expected:  "date le 2022-04-21",
+		},
+		{
+			name: "Duration",
+			condition: aFilterCondition(withFilterCondition(func(p *property) {
+				p.Name, p.Type = "duration", odata.EdmDuration
+			}, "gt", "PT1H30M")),
+			version:  odata.V4,
+			expected: "duration gt duration'PT1H30M'",
+		},
+		{
+			name:          "Invalid number",
+			condition:     aFilterCondition(withFilterCondition(int32Prop, "eq", "5 or 1 eq 1")),
+			version:       odata.V4,
+			expectedError: `filter on int32: invalid Edm.Int32 value: "5 or 1 eq 1"`,
+		},
+		{
+			name:          "Invalid guid",
+			condition:     aFilterCondition(withFilterCondition(guidProp, "eq", "abc")),
+			version:       odata.V4,
+			expectedError: `invalid Edm.Guid value: "abc"`,
+		},
+		{
+			name:          "Invalid value in list",
+			condition:     aFilterCondition(withFilterCondition(int32Prop, "in", "1, x")),
+			version:       odata.V4,
+			expectedError: `invalid Edm.Int32 value: "x"`,
+		},
+		{
+			name:          "Unsupported operator",
+			condition:     aFilterCondition(withFilterCondition(int32Prop, "like", "5")),
+			version:       odata.V4,
+			expectedError: "unsupported filter operator: like",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			condition, err := mapCondition(*table.condition, table.version)
+
+			// Assert
+			if table.expectedError != "" {
+				assert.ErrorContains(t, err, table.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, table.expected, condition)
+			}
+		})
+	}
+}
+
+func TestResolveFilterTypes(t *testing.T) {
+	// Arrange
+	metadata := aSchema(func(s *schema) {
+		s.EnumTypes["NS.Color"] = colorEnum()
+		s.TypeDefinitions["NS.Code"] = odata.EdmString
+	})
+	is := ODataSourceInstance{
+		client:   &clientMock{statusCode: 200},
+		metadata: &metadataCache{ttl: time.Hour, schema: &metadata, expires: time.Now().Add(time.Hour)},
+	}
+	ds := ODataSource{&managerMock{}}
+	conditions := someFilterConditions(withFilterCondition(func(p *property) {
+		p.Name, p.Type = "code", "NS.Code"
+	}, "eq", "A1"))
+	filter := anOrGroup(
+		aConditionNode(withFilterCondition(func(p *property) { p.Name, p.Type = "color", "NS.Color" }, "has", "Red")),
+		aConditionNode(withFilterCondition(stringProp, "eq", "null")))
+
+	// Act
+	err := ds.resolveFilterTypes(context.TODO(), &is, conditions, filter)
+
+	// Assert
+	assert.NoError(t, err)
+	result, err := combineFilters(conditions, filter, odata.V4)
+	assert.NoError(t, err)
+	assert.Equal(t, "code eq 'A1' and (color has NS.Color'Red' or string eq 'null')", result)
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"maps"
+	"slices"
+)
+
+// baseTypes returns the chain of base types of an entity type, starting with its direct base type. The chain ends at
+// a type without base type, a base type missing in the metadata or a cycle.
+func baseTypes(entityTypes map[string]entityType, name string) []string {
+	var chain []string
+	seen := map[string]bool{name: true}
+	for base := entityTypes[name].BaseType; base != ""; base = entityTypes[base].BaseType {
+		if _, ok := entityTypes[base]; !ok || seen[base] {
+			break
+		}
+		seen[base] = true
+		chain = append(chain, base)
+	}
+	return chain
+}
+
+// inheritEntityTypes merges the properties, navigation properties and key of the base types into the derived entity
+// types. Properties of base types come first, a derived type without key inherits the key of its nearest base type.
+func inheritEntityTypes(entityTypes map[string]entityType) {
+	declared := maps.Clone(entityTypes)
+	for name, et := range declared {
+		chain := baseTypes(declared, name)
+		if len(chain) == 0 {
+			continue
+		}
+		var properties []property
+		var navigationProperties []navigationProperty
+		for _, base := range slices.Backward(chain) {
+			properties = append(properties, declared[base].Properties...)
+			navigationProperties = append(navigationProperties, declared[base].NavigationProperties...)
+		}
+		for _, base := range chain {
+			if len(et.Key) > 0 {
+				break
+			}
+			et.Key = declared[base].Key
+		}
+		et.Properties = append(properties, et.Properties...)
+		et.NavigationProperties = append(navigationProperties, et.NavigationProperties...)
+		entityTypes[name] = et
+	}
+}
+
+// addTypeCastEntitySets adds the derived types of the entity sets as entity sets of their own, named by the type-cast
+// segment, e.g. "Orders/NS.SpecialOrder". Queries against them only return the entities of the derived type.
+func addTypeCastEntitySets(metadata *schema) {
+	for _, es := range slices.Collect(maps.Values(metadata.EntitySets)) {
+		for name := range metadata.EntityTypes {
+			if slices.Contains(baseTypes(metadata.EntityTypes, name), es.EntityType) {
+				castName := es.Name + "/" + name
+				metadata.EntitySets[castName] = entitySet{Name: castName, EntityType: name}
+			}
+		}
+	}
+}
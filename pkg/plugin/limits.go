@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Upper bound in megabytes of the response bodies read for a query if the data source settings do not specify one
+const defaultMaxResponseSize = 100
+
+// errRowLimitReached stops reading a response once the row limit of the data source is exceeded
+var errRowLimitReached = errors.New("row limit reached")
+
+// responseLimit is the number of bytes that may still be read from the responses of a query
+type responseLimit struct {
+	megabytes int
+	remaining int64
+}
+
+// newResponseLimit creates a limit of the given size in megabytes, zero or less for the default
+func newResponseLimit(megabytes int) *responseLimit {
+	if megabytes <= 0 {
+		megabytes = defaultMaxResponseSize
+	}
+	return &responseLimit{megabytes: megabytes, remaining: int64(megabytes) << 20}
+}
+
+func (l *responseLimit) exceeded() error {
+	return fmt.Errorf("response exceeds the maximum size of %d MB; narrow the query or raise the response size "+
+		"limit in the data source settings", l.megabytes)
+}
+
+// limitedBody reads a response body until the limit is exhausted. Reading beyond the limit fails unless the body
+// ends there.
+type limitedBody struct {
+	body  io.Reader
+	limit *responseLimit
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.limit.remaining <= 0 {
+		var probe [1]byte
+		n, err := b.body.Read(probe[:])
+		if n > 0 {
+			return 0, b.limit.exceeded()
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.limit.remaining {
+		p = p[:b.limit.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.limit.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitedBody(t *testing.T) {
+	tables := []struct {
+		name          string
+		body          string
+		remaining     int64
+		expectedError bool
+	}{
+		{
+			name:      "Within limit",
+			body:      "0123456789",
+			remaining: 20,
+		},
+		{
+			name:      "Exactly at limit",
+			body:      "0123456789",
+			remaining: 10,
+		},
+		{
+			name:          "Beyond limit",
+			body:          "0123456789",
+			remaining:     9,
+			expectedError: true,
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			limit := &responseLimit{megabytes: 1, remaining: table.remaining}
+
+			// Act
+			content, err := io.ReadAll(&limitedBody{body: strings.NewReader(table.body), limit: limit})
+
+			// Assert
+			if table.expectedError {
+				assert.EqualError(t, err, "response exceeds the maximum size of 1 MB; narrow the query or raise "+
+					"the response size limit in the data source settings")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, table.body, string(content))
+		})
+	}
+}
+
+func TestQueryResponseSizeLimit(t *testing.T) {
+	// Arrange
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":[`))
+		entity := `{"time":"2022-04-21T12:30:50Z","string":"` + strings.Repeat("x", 1000) + `"}`
+		for i := 0; i < 2000; i++ {
+			if i > 0 {
+				_, _ = w.Write([]byte(","))
+			}
+			_, _ = w.Write([]byte(entity))
+		}
+		_, _ = w.Write([]byte(`]}`))
+	})
+	is := ODataSourceInstance{client: client, settings: DatasourceSettings{MaxResponseSize: 1}}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryModel(withTimeProperty("time"), withProperties(stringProp)))
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+
+	// Assert
+	assert.ErrorContains(t, resp.Error, "response exceeds the maximum size of 1 MB")
+	assert.Empty(t, resp.Frames)
+}
@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Time the metadata is reused without revalidation if the data source settings do not specify one
+const defaultMetadataCacheTTL = 5 * time.Minute
+
+// metadataCache holds the parsed metadata of a service. Expired metadata is revalidated with the ETag of the last
+// response and concurrent requests share a single download.
+type metadataCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	schema  *schema
+	etag    string
+	expires time.Time
+	loading *metadataLoad
+	// references keeps the referenced documents of the metadata
+	references *referenceCache
+}
+
+// metadataLoad is a download of the metadata that concurrent requests wait for
+type metadataLoad struct {
+	done    chan struct{}
+	refresh bool
+	schema  *schema
+	err     error
+}
+
+// newMetadataCache creates a cache for the given time to live in seconds, zero for the default
+func newMetadataCache(ttlSeconds int) *metadataCache {
+	ttl := time.Duration(ttlSeconds) * time.Second
+	if ttlSeconds == 0 {
+		ttl = defaultMetadataCacheTTL
+	}
+	return &metadataCache{ttl: ttl, references: newReferenceCache()}
+}
+
+// get returns the cached metadata, or loads it if it expired or refresh is set. A refresh does not wait for a download
+// that started before, as it may return the metadata that is to be replaced. A nil cache loads the metadata on every
+// call.
+func (c *metadataCache) get(ctx context.Context, client ODataClient, refresh bool) (*schema, error) {
+	if c == nil {
+		metadata, _, err := loadMetadata(ctx, client, "", nil)
+		return metadata, err
+	}
+	c.mu.Lock()
+	if !refresh && c.schema != nil && time.Now().Before(c.expires) {
+		metadata := c.schema
+		c.mu.Unlock()
+		return metadata, nil
+	}
+	load := c.loading
+	if load == nil || refresh && !load.refresh {
+		load = &metadataLoad{done: make(chan struct{}), refresh: refresh}
+		c.loading = load
+		etag := c.etag
+		if refresh {
+			etag = ""
+			c.references = newReferenceCache()
+		}
+		// The download must not be cancelled by the request that started it while others wait for it
+		go c.load(context.WithoutCancel(ctx), client, load, etag, c.references)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-load.done:
+		return load.schema, load.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *metadataCache) load(ctx context.Context, client ODataClient, load *metadataLoad, etag string,
+	references *referenceCache) {
+	metadata, newEtag, err := loadMetadata(ctx, client, etag, references)
+	c.mu.Lock()
+	if err == nil && metadata == nil {
+		log.DefaultLogger.Debug("Metadata not modified", "etag", etag)
+		metadata = c.schema
+	}
+	// A download superseded by a refresh only returns its result to the requests waiting for it
+	if c.loading == load {
+		if err == nil {
+			c.schema = metadata
+			c.etag = newEtag
+			c.expires = time.Now().Add(c.ttl)
+		}
+		c.loading = nil
+	}
+	c.mu.Unlock()
+	load.schema, load.err = metadata, err
+	close(load.done)
+}
+
+// versionRecorder is implemented by clients that build their requests for the OData version of the service
+type versionRecorder interface {
+	rememberVersion(version string)
+}
+
+// loadMetadata downloads and parses the metadata document and the documents it references, which are taken from the
+// given cache if possible. It returns no metadata if the document did not change since the given ETag.
+func loadMetadata(ctx context.Context, client ODataClient, etag string,
+	references *referenceCache) (*schema, string, error) {
+	resp, err := client.GetMetadata(ctx, etag)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		return nil, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", newResponseError("get metadata", resp)
+	}
+	bodyBytes, err := io.ReadAll(resp.Body)
+	// Release the request slot before the references are requested, the client may allow a single request only
+	_ = resp.Body.Close()
+	if err != nil {
+		log.DefaultLogger.Error("error reading response body")
+		return nil, "", err
+	}
+	var edmx odata.Edmx
+	err = xml.Unmarshal(bodyBytes, &edmx)
+	if err != nil {
+		log.DefaultLogger.Error("error unmarshalling response body")
+		return nil, "", err
+	}
+
+	loadReferences(ctx, client, &edmx, references)
+
+	version := odata.VersionFromHeader(resp.Header)
+	if version == "" {
+		version = edmx.ODataVersion()
+	}
+	// Requests are built for the version of the metadata if the service does not announce it in its responses
+	if recorder, ok := client.(versionRecorder); ok {
+		recorder.rememberVersion(version)
+	}
+	return newSchema(edmx, version), resp.Header.Get("ETag"), nil
+}
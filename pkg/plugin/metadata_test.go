@@ -0,0 +1,168 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const minimalMetadata = `<?xml version="1.0" encoding="utf-8"?><edmx:Edmx Version="4.0" ` +
+	`xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx"><edmx:DataServices>` +
+	`<Schema Namespace="NS" xmlns="http://docs.oasis-open.org/odata/ns/edm">` +
+	`<EntityContainer Name="Container"><EntitySet Name="Orders" EntityType="NS.Order"/></EntityContainer>` +
+	`</Schema></edmx:DataServices></edmx:Edmx>`
+
+// metadataHandler serves the metadata with an ETag and records the If-None-Match headers of the requests
+func metadataHandler(requests *atomic.Int32, conditional *atomic.Int32) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(minimalMetadata))
+	}
+}
+
+func TestMetadataCache(t *testing.T) {
+	tables := []struct {
+		name                string
+		ttl                 int
+		refresh             bool
+		expectedRequests    int32
+		expectedConditional int32
+	}{
+		{
+			name:             "Cached",
+			expectedRequests: 1,
+		},
+		{
+			name:                "Revalidated",
+			ttl:                 -1,
+			expectedRequests:    2,
+			expectedConditional: 1,
+		},
+		{
+			name:             "Refreshed",
+			refresh:          true,
+			expectedRequests: 2,
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			var requests, conditional atomic.Int32
+			client := GetOC("/$metadata", metadataHandler(&requests, &conditional))
+			cache := newMetadataCache(table.ttl)
+			first, err := cache.get(context.TODO(), client, false)
+			require.NoError(t, err)
+
+			// Act
+			second, err := cache.get(context.TODO(), client, table.refresh)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, table.expectedRequests, requests.Load())
+			assert.Equal(t, table.expectedConditional, conditional.Load())
+			assert.Contains(t, second.EntitySets, "Orders")
+			assert.Equal(t, first, second)
+		})
+	}
+}
+
+func TestMetadataCacheConcurrentLoads(t *testing.T) {
+	// Arrange
+	var requests atomic.Int32
+	release := make(chan struct{})
+	client := GetOC("/$metadata", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_, _ = w.Write([]byte(minimalMetadata))
+	})
+	cache := newMetadataCache(0)
+
+	// Act
+	var wg sync.WaitGroup
+	results := make([]*schema, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = cache.get(context.TODO(), client, false)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, int32(1), requests.Load())
+	for _, result := range results {
+		require.NotNil(t, result)
+		assert.Same(t, results[0], result)
+	}
+}
+
+func TestMetadataCacheRefreshDuringLoad(t *testing.T) {
+	// Arrange
+	var requests atomic.Int32
+	release := make(chan struct{})
+	client := GetOC("/$metadata", func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			<-release
+			_, _ = w.Write([]byte(minimalMetadata))
+			return
+		}
+		_, _ = w.Write([]byte(strings.ReplaceAll(minimalMetadata, "Orders", "Invoices")))
+	})
+	cache := newMetadataCache(0)
+	loaded := make(chan *schema)
+	go func() {
+		metadata, _ := cache.get(context.TODO(), client, false)
+		loaded <- metadata
+	}()
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+
+	// Act
+	refreshed, err := cache.get(context.TODO(), client, true)
+	close(release)
+	superseded := <-loaded
+	cached, cachedErr := cache.get(context.TODO(), client, false)
+
+	// Assert
+	require.NoError(t, err)
+	require.NoError(t, cachedErr)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Contains(t, refreshed.EntitySets, "Invoices")
+	assert.Contains(t, superseded.EntitySets, "Orders")
+	assert.Same(t, refreshed, cached)
+}
+
+func TestMetadataCacheError(t *testing.T) {
+	// Arrange
+	var requests atomic.Int32
+	client := GetOC("/$metadata", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	cache := newMetadataCache(0)
+
+	// Act
+	_, firstErr := cache.get(context.TODO(), client, false)
+	_, secondErr := cache.get(context.TODO(), client, false)
+
+	// Assert
+	assert.EqualError(t, firstErr, "get metadata failed with status code 503")
+	assert.Error(t, secondErr)
+	assert.Equal(t, int32(2), requests.Load())
+}
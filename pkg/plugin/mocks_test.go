@@ -31,12 +31,22 @@ func (client *clientMock) GetServiceRoot(_ context.Context) (*http.Response, err
 		Body: io.NopCloser(bytes.NewReader(client.body))}, client.err
 }
 
-func (client *clientMock) GetMetadata(_ context.Context) (*http.Response, error) {
+func (client *clientMock) GetMetadata(_ context.Context, _ string) (*http.Response, error) {
 	return &http.Response{StatusCode: client.statusCode,
 		Body: io.NopCloser(bytes.NewReader(client.body))}, client.err
 }
 
-func (client *clientMock) Get(_ context.Context, _ string, _ []property, _ []filterCondition) (*http.Response, error) {
+func (client *clientMock) Get(_ context.Context, _ string, _ queryOptions) (*http.Response, error) {
+	return &http.Response{StatusCode: client.statusCode,
+		Body: io.NopCloser(bytes.NewReader(client.body))}, client.err
+}
+
+func (client *clientMock) GetNextPage(_ context.Context, _ string) (*http.Response, error) {
+	return &http.Response{StatusCode: client.statusCode,
+		Body: io.NopCloser(bytes.NewReader(client.body))}, client.err
+}
+
+func (client *clientMock) GetReference(_ context.Context, _ string) (*http.Response, error) {
 	return &http.Response{StatusCode: client.statusCode,
 		Body: io.NopCloser(bytes.NewReader(client.body))}, client.err
 }
@@ -1,35 +1,155 @@
 package plugin
 
+import "strings"
+
+// Properties of related entities are given as path of navigation property and property, e.g. "Customer/Name"
 type queryModel struct {
 	EntitySet        entitySet         `json:"entitySet"`
 	TimeProperty     *property         `json:"timeProperty"`
 	Properties       []property        `json:"properties"`
 	FilterConditions []filterCondition `json:"filterConditions"`
+	Filter           *filterNode       `json:"filter"`
+	Aggregation      *aggregation      `json:"aggregation"`
+	Annotation       *annotation       `json:"annotation"`
+	Count            *countOptions     `json:"count"`
+	OrderBy          []orderBy         `json:"orderBy"`
+	// NumericEnums returns the numeric values of enum properties instead of the member names
+	NumericEnums bool `json:"numericEnums,omitempty"`
+	// Explode is the name of a selected collection property whose elements each get a row of their own
+	Explode string `json:"explode,omitempty"`
+	// Search is a free-text search expression like `blue OR "dark green"`, combined with the filters
+	Search string `json:"search"`
+	// Top limits the number of entities or aggregated rows, 0 for no limit
+	Top int64 `json:"top"`
+	// Variables holds the current values of the dashboard variables, which are resolved in the backend
+	Variables map[string][]string `json:"variables,omitempty"`
+}
+
+// countOptions configures queries of type queryTypeCount
+type countOptions struct {
+	// TimeBucket counts per time interval of the time property like aggregation.TimeBucket, empty for a single count
+	TimeBucket string `json:"timeBucket"`
+}
+
+// orderBy sorts the result by a property, Direction is "asc" (default) or "desc"
+type orderBy struct {
+	Property  property `json:"property"`
+	Direction string   `json:"direction,omitempty"`
+}
+
+// aggregation describes a server-side aggregation via $apply, used by queries of type queryTypeAggregation
+type aggregation struct {
+	GroupBy    []property  `json:"groupBy"`
+	Aggregates []aggregate `json:"aggregates"`
+	// TimeBucket aggregates per time interval of the time property: "auto" for the query interval or a duration
+	// like "15m" or "1d". Empty to aggregate over the whole time range.
+	TimeBucket string `json:"timeBucket"`
+}
+
+// annotation maps properties to the fields of Grafana annotations, used by queries of type queryTypeAnnotations. The
+// time property of the query is the start time of the annotations.
+type annotation struct {
+	// TimeEndProperty turns the annotations into regions
+	TimeEndProperty *property  `json:"timeEndProperty"`
+	TitleProperty   *property  `json:"titleProperty"`
+	TextProperty    *property  `json:"textProperty"`
+	TagProperties   []property `json:"tagProperties"`
+}
+
+type aggregate struct {
+	Property property `json:"property"`
+	Method   string   `json:"method"`
+	Alias    string   `json:"alias"`
 }
 
 type schema struct {
-	EntityTypes map[string]entityType `json:"entityTypes"`
-	EntitySets  map[string]entitySet  `json:"entitySets"`
+	Version      string                 `json:"version"`
+	EntityTypes  map[string]entityType  `json:"entityTypes"`
+	ComplexTypes map[string]complexType `json:"complexTypes"`
+	EnumTypes    map[string]enumType    `json:"enumTypes"`
+	// TypeDefinitions maps the qualified names of type definitions to their underlying primitive type
+	TypeDefinitions map[string]string    `json:"typeDefinitions"`
+	EntitySets      map[string]entitySet `json:"entitySets"`
 }
 
-type entityType struct {
+// complexType is a structured type of properties. The editor offers its properties as paths like "Address/City".
+type complexType struct {
 	Name          string     `json:"name"`
 	QualifiedName string     `json:"qualifiedName"`
 	Properties    []property `json:"properties"`
 }
 
+// enumType is a type of named values, the members are listed in the order of the metadata
+type enumType struct {
+	Name           string       `json:"name"`
+	QualifiedName  string       `json:"qualifiedName"`
+	UnderlyingType string       `json:"underlyingType"`
+	IsFlags        bool         `json:"isFlags"`
+	Members        []enumMember `json:"members"`
+}
+
+type enumMember struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// entityType lists the declared and inherited properties of an entity type, the properties of the base types first
+type entityType struct {
+	Name                 string               `json:"name"`
+	QualifiedName        string               `json:"qualifiedName"`
+	BaseType             string               `json:"baseType,omitempty"`
+	Abstract             bool                 `json:"abstract,omitempty"`
+	Key                  []string             `json:"key,omitempty"`
+	Properties           []property           `json:"properties"`
+	NavigationProperties []navigationProperty `json:"navigationProperties"`
+}
+
+type navigationProperty struct {
+	Name       string `json:"name"`
+	EntityType string `json:"entityType"`
+	Collection bool   `json:"collection"`
+}
+
 type entitySet struct {
 	Name       string `json:"name"`
 	EntityType string `json:"entityType"`
 }
 
+// property is a property of the entity type, a property of a related entity given as path of navigation property and
+// property, e.g. "Customer/Name", or a property of a complex type given as path, e.g. "Address/City". Before the
+// properties are selected, resolveSelectPaths separates the properties of complex types by "." instead.
 type property struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
+	// enum is set for enum properties whose values are mapped to numbers or formatted as enum literals in filters
+	enum *enumType
+}
+
+// path returns the property path used in URLs, which separates the properties of complex types by "/" as well
+func (p property) path() string {
+	return strings.ReplaceAll(p.Name, ".", "/")
+}
+
+// aliasName turns a property path into an identifier for aliases in $apply, e.g. "Address_City"
+func aliasName(name string) string {
+	return strings.NewReplacer("/", "_", ".", "_").Replace(name)
+}
+
+// filterNode is a node of a filter tree, either a single condition or a group that combines its children with "and"
+// or "or". Both can be negated.
+type filterNode struct {
+	Operator  string           `json:"operator,omitempty"`
+	Not       bool             `json:"not,omitempty"`
+	Children  []filterNode     `json:"children,omitempty"`
+	Condition *filterCondition `json:"condition,omitempty"`
 }
 
 type filterCondition struct {
 	Property property `json:"property"`
 	Operator string   `json:"operator"`
 	Value    string   `json:"value"`
+	// Values of list operators like "in". If empty, Value is read as comma separated list. Other operators are
+	// applied to each of the values, e.g. after expanding a multi-value variable.
+	Values          []string `json:"values,omitempty"`
+	CaseInsensitive bool     `json:"caseInsensitive,omitempty"`
 }
@@ -0,0 +1,178 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// DecodeResponse reads a response page from r as a stream. onEntity is called for each entity of the entity array with
+// the decoder positioned at the entity and must read it completely, e.g. via DecodeEntity, so that neither the body
+// nor the entities of the page are held in memory. The returned response carries the next link and count but no
+// entities. If onEntity returns an error, decoding stops and the error is returned as is. Numbers are decoded as
+// json.Number, which keeps their original text for values emitted as JSON.
+func DecodeResponse(r io.Reader, onEntity func(dec *json.Decoder) error) (*Response, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	d := &responseDecoder{
+		dec:      dec,
+		onEntity: onEntity,
+		result:   &Response{},
+	}
+	if err := expectDelim(d.dec, '{'); err != nil {
+		return nil, err
+	}
+	if err := d.readObject(false); err != nil {
+		return nil, err
+	}
+	return d.result, nil
+}
+
+type responseDecoder struct {
+	dec      *json.Decoder
+	onEntity func(dec *json.Decoder) error
+	result   *Response
+}
+
+// readObject reads the members of the top level object or, if inner is set, of the V2 "d" object up to the closing
+// brace. It accepts the V4 (and V3 JSON light) format {"value":[...]} as well as the V2 format {"d":{"results":[...]}}
+// and the V1 format {"d":[...]}.
+func (d *responseDecoder) readObject(inner bool) error {
+	for d.dec.More() {
+		token, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		switch {
+		case key == "value" && !inner, key == "results" && inner:
+			err = d.readEntities()
+		case key == "@odata.nextLink", key == "odata.nextLink", key == "__next":
+			err = d.dec.Decode(&d.result.NextLink)
+		case key == "@odata.count", key == "odata.count", key == "__count":
+			var raw json.RawMessage
+			if err = d.dec.Decode(&raw); err == nil {
+				d.result.Count, err = parseCount(raw)
+			}
+		case key == "d" && !inner:
+			err = d.readD()
+		default:
+			var skipped json.RawMessage
+			err = d.dec.Decode(&skipped)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(d.dec, '}')
+}
+
+// readD reads the V2 object {"results":[...]} or the V1 array of entities
+func (d *responseDecoder) readD() error {
+	token, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		return d.readObject(true)
+	case json.Delim('['):
+		return d.readArray()
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("unexpected %v in response", token)
+}
+
+// readEntities reads an array of entities, which may be null
+func (d *responseDecoder) readEntities() error {
+	token, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('['):
+		return d.readArray()
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("unexpected %v in response, expected entity array", token)
+}
+
+// readArray reads the entities of an array up to the closing bracket
+func (d *responseDecoder) readArray() error {
+	for d.dec.More() {
+		if err := d.onEntity(d.dec); err != nil {
+			return err
+		}
+	}
+	return expectDelim(d.dec, ']')
+}
+
+// DecodeEntity reads an entity object from dec and passes the values of the properties for which selected returns
+// true to onProperty. Other properties, e.g. annotations or properties the service returns unasked, are skipped
+// without decoding their values. A null entity has no properties.
+func DecodeEntity(dec *json.Decoder, selected func(name string) bool,
+	onProperty func(name string, value interface{})) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("unexpected %v in response, expected entity", token)
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name, _ := token.(string)
+		if !selected(name) {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+			continue
+		}
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		onProperty(name, value)
+	}
+	return expectDelim(dec, '}')
+}
+
+// skipValue reads the next value from dec token by token without holding it in memory
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected %v in response, expected %v", token, delim)
+	}
+	return nil
+}
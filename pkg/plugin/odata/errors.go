@@ -0,0 +1,140 @@
+package odata
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+)
+
+// Error is the error payload of a service response, {"error":{...}} in JSON (V3 JSON light uses "odata.error") or
+// <m:error> in XML, which V2 services send by default
+type Error struct {
+	Code    string
+	Message string
+	Target  string
+	// Details are the V4 error details or the error details of the inner error of SAP Gateway services
+	Details []ErrorDetail
+}
+
+type ErrorDetail struct {
+	Code    string
+	Message string
+	Target  string
+}
+
+// Error formats the error like "code: message (detail; detail)"
+func (e *Error) Error() string {
+	var sb strings.Builder
+	if e.Code != "" {
+		sb.WriteString(e.Code)
+		sb.WriteString(": ")
+	}
+	sb.WriteString(e.Message)
+	if e.Target != "" {
+		sb.WriteString(" [" + e.Target + "]")
+	}
+	var details []string
+	for _, d := range e.Details {
+		// SAP Gateway repeats the message as first detail
+		if d.Message != "" && d.Message != e.Message {
+			details = append(details, d.Message)
+		}
+	}
+	if len(details) > 0 {
+		sb.WriteString(" (" + strings.Join(details, "; ") + ")")
+	}
+	return sb.String()
+}
+
+// ParseError parses the error payload of a failed request. It returns nil if the body is no OData error.
+func ParseError(body []byte) *Error {
+	body = bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	if len(body) == 0 {
+		return nil
+	}
+	var result *Error
+	switch body[0] {
+	case '{':
+		result = parseJSONError(body)
+	case '<':
+		result = parseXMLError(body)
+	}
+	if result == nil || result.Code == "" && result.Message == "" {
+		return nil
+	}
+	return result
+}
+
+type jsonError struct {
+	Code       string          `json:"code"`
+	Message    json.RawMessage `json:"message"`
+	Target     string          `json:"target"`
+	Details    []jsonError     `json:"details"`
+	InnerError struct {
+		ErrorDetails []jsonError `json:"errordetails"`
+	} `json:"innererror"`
+}
+
+func parseJSONError(body []byte) *Error {
+	var payload struct {
+		Error   *jsonError `json:"error"`
+		ErrorV3 *jsonError `json:"odata.error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil
+	}
+	e := payload.Error
+	if e == nil {
+		e = payload.ErrorV3
+	}
+	if e == nil {
+		return nil
+	}
+	result := &Error{Code: e.Code, Message: jsonMessage(e.Message), Target: e.Target}
+	for _, d := range append(e.Details, e.InnerError.ErrorDetails...) {
+		result.Details = append(result.Details, ErrorDetail{Code: d.Code, Message: jsonMessage(d.Message),
+			Target: d.Target})
+	}
+	return result
+}
+
+// jsonMessage reads a V4 message string or a V2/V3 message object {"lang":"en","value":"..."}
+func jsonMessage(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var localized struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &localized); err == nil {
+		return localized.Value
+	}
+	return ""
+}
+
+type xmlErrorDetail struct {
+	Code    string `xml:"code"`
+	Message string `xml:"message"`
+	Target  string `xml:"target"`
+}
+
+func parseXMLError(body []byte) *Error {
+	var payload struct {
+		XMLName    xml.Name `xml:"error"`
+		Code       string   `xml:"code"`
+		Message    string   `xml:"message"`
+		InnerError struct {
+			ErrorDetails []xmlErrorDetail `xml:"errordetails>errordetail"`
+		} `xml:"innererror"`
+	}
+	if err := xml.Unmarshal(body, &payload); err != nil {
+		return nil
+	}
+	result := &Error{Code: payload.Code, Message: strings.TrimSpace(payload.Message)}
+	for _, d := range payload.InnerError.ErrorDetails {
+		result.Details = append(result.Details, ErrorDetail{Code: d.Code, Message: d.Message, Target: d.Target})
+	}
+	return result
+}
@@ -1,12 +1,35 @@
 package odata
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// V2 JSON date format, e.g. /Date(1700000000000)/ or /Date(1700000000000+0060)/ (offset in minutes)
+var v2DatePattern = regexp.MustCompile(`^/Date\((-?\d+)([+-]\d+)?\)/$`)
+
+// IsJSON reports whether values of the property type are kept as JSON, which applies to collections and untyped values
+func IsJSON(propertyType string) bool {
+	return propertyType == EdmUntyped || strings.HasPrefix(propertyType, "Collection(")
+}
+
+// ElementType returns the type of the elements of a collection type, e.g. "Edm.String" for "Collection(Edm.String)"
+func ElementType(propertyType string) (string, bool) {
+	if !strings.HasPrefix(propertyType, "Collection(") || !strings.HasSuffix(propertyType, ")") {
+		return "", false
+	}
+	return propertyType[len("Collection(") : len(propertyType)-1], true
+}
+
 // ToArray maps OData property types to Grafana Field type
 func ToArray(propertyType string) interface{} {
+	if IsJSON(propertyType) {
+		return []*json.RawMessage{}
+	}
 	switch propertyType {
 	case EdmBoolean:
 		return []*bool{}
@@ -26,7 +49,7 @@ func ToArray(propertyType string) interface{} {
 		return []*int32{}
 	case EdmInt64:
 		return []*int64{}
-	case EdmDateTimeOffset:
+	case EdmDateTimeOffset, EdmDateTime:
 		return []*time.Time{}
 	case EdmDate:
 		return []*time.Time{}
@@ -40,23 +63,52 @@ func MapValue(value interface{}, propertyType string) interface{} {
 	if value == nil {
 		return nil
 	}
+	if IsJSON(propertyType) {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+		message := json.RawMessage(raw)
+		return &message
+	}
 	switch propertyType {
 	case EdmBoolean:
 		boolValue := value.(bool)
 		return &boolValue
 	case EdmSingle, EdmDecimal, EdmDouble, EdmSByte, EdmByte, EdmInt16, EdmInt32, EdmInt64:
-		result, err := mapNumber(value.(float64), propertyType)
+		if s, ok := value.(string); ok && propertyType == EdmInt64 {
+			value = json.Number(s)
+		}
+		if n, ok := value.(json.Number); ok && propertyType == EdmInt64 {
+			// Parse directly to keep the full 64-bit precision
+			if i, err := n.Int64(); err == nil {
+				return &i
+			}
+		}
+		number, err := toFloat(value)
+		if err != nil {
+			return nil
+		}
+		result, err := mapNumber(number, propertyType)
 		if err != nil {
 			return nil
 		}
 		return result
-	case EdmDateTimeOffset, EdmDate:
-		if timeValue, err := time.Parse(time.RFC3339Nano, fmt.Sprint(value)); err == nil {
+	case EdmDateTimeOffset, EdmDateTime, EdmDate:
+		if timeValue, err := parseTime(fmt.Sprint(value)); err == nil {
 			return &timeValue
 		} else {
 			return nil
 		}
 	default:
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			// Structured values of properties that are not known as JSON are rendered as JSON text
+			if raw, err := json.Marshal(value); err == nil {
+				x := string(raw)
+				return &x
+			}
+		}
 		x := fmt.Sprint(value)
 		return &x
 	}
@@ -88,3 +140,56 @@ func mapNumber(value float64, propertyType string) (interface{}, error) {
 		return nil, fmt.Errorf("unexpected property type: %s", propertyType)
 	}
 }
+
+// toFloat converts a JSON number to float64. V2 services (and V4 services with IEEE754Compatible=true) encode
+// Edm.Int64 and Edm.Decimal values as strings.
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("unexpected number value: %v", value)
+	}
+}
+
+// parseTime parses V4 (RFC3339, date only) and V2 (/Date(ms)/, ISO without offset) date values
+func parseTime(value string) (time.Time, error) {
+	if match := v2DatePattern.FindStringSubmatch(value); match != nil {
+		ms, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		// The optional offset only describes the original time zone, the milliseconds are always UTC based
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unexpected time value: %s", value)
+}
+
+// LookupValue returns the value of a property of an entity. Properties of expanded single-valued navigation
+// properties and of complex types are addressed by path, e.g. "Customer/Name" or "Address/City". Properties of
+// complex types may also be separated by dots, e.g. "Address.City".
+func LookupValue(entity map[string]interface{}, path string) (interface{}, bool) {
+	name, rest, nested := path, "", false
+	if i := strings.IndexAny(path, "/."); i >= 0 {
+		name, rest, nested = path[:i], path[i+1:], true
+	}
+	value, ok := entity[name]
+	if !ok || !nested {
+		return value, ok
+	}
+	related, isObject := value.(map[string]interface{})
+	if !isObject {
+		// Not expanded, null or collection-valued
+		return nil, false
+	}
+	return LookupValue(related, rest)
+}
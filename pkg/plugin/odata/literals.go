@@ -0,0 +1,158 @@
+package odata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	guidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	decimalPattern  = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+	durationPattern = regexp.MustCompile(`^-?P(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+	// Enum members are identifiers or numeric values, flags are separated by commas
+	enumPattern = regexp.MustCompile(`^[\w-]+(\s*,\s*[\w-]+)*$`)
+	// Values of other primitive types (e.g. geo or binary) are passed through if they cannot break the expression
+	plainPattern = regexp.MustCompile(`^[\w.:+-]+$`)
+
+	dateTimeLayouts  = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02T15:04"}
+	timeOfDayLayouts = []string{"15:04:05.999999999", "15:04"}
+)
+
+// FormatLiteral formats a value as URL literal of the given property type, e.g. quoted strings with escaped quotes or
+// guid'...' for Edm.Guid on V2 services. Values which are not valid for the type are rejected instead of producing
+// a malformed request. Values of unknown type are only passed through if they are plain tokens. "null" is the null
+// literal except for strings, which are always quoted. Enum values are formatted by FormatEnumLiteral.
+func FormatLiteral(propertyType string, value string, version string) (string, error) {
+	if value == Null && propertyType != EdmString {
+		return Null, nil
+	}
+	invalid := func() (string, error) {
+		return "", fmt.Errorf("invalid %s value: %q", propertyType, value)
+	}
+	v2 := IsV2(version)
+	switch propertyType {
+	case EdmString:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'", nil
+	case EdmBoolean:
+		switch strings.ToLower(value) {
+		case "true", "false":
+			return strings.ToLower(value), nil
+		}
+		return invalid()
+	case EdmByte:
+		if _, err := strconv.ParseUint(value, 10, 8); err != nil {
+			return invalid()
+		}
+		return value, nil
+	case EdmSByte, EdmInt16, EdmInt32, EdmInt64:
+		if _, err := strconv.ParseInt(value, 10, intSize(propertyType)); err != nil {
+			return invalid()
+		}
+		if v2 && propertyType == EdmInt64 {
+			return value + "L", nil
+		}
+		return value, nil
+	case EdmDecimal:
+		if !decimalPattern.MatchString(value) {
+			return invalid()
+		}
+		if v2 {
+			return value + "M", nil
+		}
+		return value, nil
+	case EdmSingle, EdmDouble:
+		switch value {
+		case "INF", "-INF", "NaN":
+			return value, nil
+		}
+		if !decimalPattern.MatchString(value) {
+			return invalid()
+		}
+		return value, nil
+	case EdmGuid:
+		if !guidPattern.MatchString(value) {
+			return invalid()
+		}
+		if v2 {
+			return "guid'" + value + "'", nil
+		}
+		return value, nil
+	case EdmDate:
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+		// Time range values are sent as date of the instant
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t.UTC().Format("2006-01-02"), nil
+		}
+		return invalid()
+	case EdmDateTimeOffset:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return invalid()
+		}
+		if v2 {
+			return "datetimeoffset'" + t.Format(time.RFC3339Nano) + "'", nil
+		}
+		return t.Format(time.RFC3339Nano), nil
+	case EdmDateTime:
+		// Edm.DateTime has no offset, values with offset are sent as UTC
+		for _, layout := range dateTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return "datetime'" + t.UTC().Format("2006-01-02T15:04:05.999999999") + "'", nil
+			}
+		}
+		return invalid()
+	case EdmTimeOfDay:
+		for _, layout := range timeOfDayLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t.Format("15:04:05.999999999"), nil
+			}
+		}
+		return invalid()
+	case EdmDuration, EdmTime:
+		if !durationPattern.MatchString(value) || value == "P" || value == "-P" || strings.HasSuffix(value, "T") {
+			return invalid()
+		}
+		if propertyType == EdmTime {
+			return "time'" + value + "'", nil
+		}
+		return "duration'" + value + "'", nil
+	}
+	if !plainPattern.MatchString(value) {
+		return invalid()
+	}
+	return value, nil
+}
+
+// FormatEnumLiteral qualifies enum members with the qualified name of the enum type, e.g. NS.Color'Red'. Values which
+// are already qualified with the type are accepted as they are.
+func FormatEnumLiteral(enumType string, value string) (string, error) {
+	if value == Null {
+		return Null, nil
+	}
+	members := value
+	if strings.HasPrefix(value, enumType+"'") && strings.HasSuffix(value, "'") && len(value) > len(enumType)+1 {
+		members = value[len(enumType)+1 : len(value)-1]
+	}
+	if !enumPattern.MatchString(members) {
+		return "", fmt.Errorf("invalid %s value: %q", enumType, value)
+	}
+	return enumType + "'" + members + "'", nil
+}
+
+func intSize(propertyType string) int {
+	switch propertyType {
+	case EdmSByte:
+		return 8
+	case EdmInt16:
+		return 16
+	case EdmInt32:
+		return 32
+	default:
+		return 64
+	}
+}
@@ -1,6 +1,14 @@
 package odata
 
-import "encoding/xml"
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
 
 const (
 	EdmString         = "Edm.String"
@@ -14,46 +22,236 @@ const (
 	EdmInt32          = "Edm.Int32"
 	EdmInt64          = "Edm.Int64"
 	EdmDateTimeOffset = "Edm.DateTimeOffset"
+	EdmDateTime       = "Edm.DateTime"
 	EdmGuid           = "Edm.Guid"
 	EdmTime           = "Edm.Time"
 	EdmDate           = "Edm.Date"
+	EdmTimeOfDay      = "Edm.TimeOfDay"
+	EdmDuration       = "Edm.Duration"
+	EdmUntyped        = "Edm.Untyped"
+
+	// Null is the null literal, which is accepted as filter value for properties of any type but strings, where it is
+	// the string "null"
+	Null = "null"
+
+	V2 = "2.0"
+	V4 = "4.0"
+
+	HeaderODataVersion       = "OData-Version"
+	HeaderDataServiceVersion = "DataServiceVersion"
 
 	Metadata = "$metadata"
 	Filter   = "$filter"
 	Select   = "$select"
+	Expand   = "$expand"
+	Apply    = "$apply"
+	OrderBy  = "$orderby"
+	Top      = "$top"
+	Count    = "$count"
+	Search   = "$search"
+	// SearchV2 is the custom query option for free-text search of V2 services, which do not support $search
+	SearchV2 = "search"
+	// InlineCount requests the total count with the entities on V2 services, V4 services use Count=true
+	InlineCount = "$inlinecount"
+	// Batch is the resource that executes several requests sent as multipart/mixed or, since V4.01, JSON document
+	Batch = "$batch"
+
+	AggregateSum           = "sum"
+	AggregateAverage       = "average"
+	AggregateMin           = "min"
+	AggregateMax           = "max"
+	AggregateCountDistinct = "countdistinct"
+	// AggregateCount counts the entities of a group via the virtual property $count
+	AggregateCount = "count"
 )
 
 type Response struct {
-	Value []map[string]interface{} `json:"value"`
+	Value    []map[string]interface{} `json:"value"`
+	NextLink string                   `json:"@odata.nextLink,omitempty"`
+	// Count is the total number of matching entities if requested via $count=true or $inlinecount=allpages
+	Count *int64 `json:"@odata.count,omitempty"`
+}
+
+// UnmarshalJSON accepts the V4 (and V3 JSON light) format {"value":[...]} as well as the V2 format
+// {"d":{"results":[...]}} and the V1 format {"d":[...]}
+func (r *Response) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Value      []map[string]interface{} `json:"value"`
+		NextLink   string                   `json:"@odata.nextLink"`
+		NextLinkV3 string                   `json:"odata.nextLink"`
+		Count      json.RawMessage          `json:"@odata.count"`
+		CountV3    json.RawMessage          `json:"odata.count"`
+		D          json.RawMessage          `json:"d"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	r.Value = raw.Value
+	r.NextLink = raw.NextLink
+	if r.NextLink == "" {
+		r.NextLink = raw.NextLinkV3
+	}
+	count, err := parseCount(raw.Count, raw.CountV3)
+	if err != nil {
+		return err
+	}
+	r.Count = count
+	d := bytes.TrimSpace(raw.D)
+	if len(d) == 0 {
+		return nil
+	}
+	if d[0] == '[' {
+		return json.Unmarshal(d, &r.Value)
+	}
+	var v2 struct {
+		Results []map[string]interface{} `json:"results"`
+		Next    string                   `json:"__next"`
+		Count   json.RawMessage          `json:"__count"`
+	}
+	if err := json.Unmarshal(d, &v2); err != nil {
+		return err
+	}
+	r.Value = v2.Results
+	r.NextLink = v2.Next
+	r.Count, err = parseCount(v2.Count)
+	return err
+}
+
+// parseCount parses the first present count annotation. Counts are numbers in V4 and strings in V2/V3 (and in V4
+// with IEEE754Compatible=true).
+func parseCount(candidates ...json.RawMessage) (*int64, error) {
+	for _, candidate := range candidates {
+		if len(candidate) == 0 || string(candidate) == "null" {
+			continue
+		}
+		text := strings.Trim(string(candidate), `"`)
+		count, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid count %s: %w", candidate, err)
+		}
+		return &count, nil
+	}
+	return nil, nil
+}
+
+// VersionFromHeader returns the OData version announced by a service response, e.g. "4.0" or "2.0". V2 services
+// send values like "2.0;NetFx" which are reduced to the version number.
+func VersionFromHeader(header http.Header) string {
+	version := header.Get(HeaderODataVersion)
+	if version == "" {
+		version = header.Get(HeaderDataServiceVersion)
+	}
+	version, _, _ = strings.Cut(version, ";")
+	return strings.TrimSpace(version)
+}
+
+// IsV401 reports whether the given version is 4.01 or newer, which adds e.g. the "in" operator
+func IsV401(version string) bool {
+	majorPart, minorPart, _ := strings.Cut(version, ".")
+	major, err := strconv.Atoi(majorPart)
+	if err != nil {
+		return false
+	}
+	minor, _ := strconv.Atoi(minorPart)
+	return major > 4 || major == 4 && minor >= 1
+}
+
+// IsV2 reports whether the given version uses the V2 (or older) conventions for URLs and payloads
+func IsV2(version string) bool {
+	return strings.HasPrefix(version, "1.") || strings.HasPrefix(version, "2.") || strings.HasPrefix(version, "3.")
 }
 
 type Edmx struct {
 	XMLName      xml.Name        `xml:"Edmx"`
 	Version      string          `xml:"Version,attr"`
 	XmlNs        string          `xml:"edmx,attr"`
+	References   []*Reference    `xml:"Reference"`
 	DataServices []*DataServices `xml:"DataServices"`
 }
 
+// Reference points to a further metadata document, the includes list the namespaces used from it and their aliases
+type Reference struct {
+	XMLName  xml.Name   `xml:"Reference"`
+	Uri      string     `xml:"Uri,attr"`
+	Includes []*Include `xml:"Include"`
+}
+
+type Include struct {
+	XMLName   xml.Name `xml:"Include"`
+	Namespace string   `xml:"Namespace,attr"`
+	Alias     string   `xml:"Alias,attr,omitempty"`
+}
+
+// ODataVersion returns the OData version of the service. V2 services declare "1.0" as Edmx version and the actual
+// protocol version in the m:DataServiceVersion attribute of DataServices.
+func (edmx *Edmx) ODataVersion() string {
+	for _, ds := range edmx.DataServices {
+		if ds.DataServiceVersion != "" {
+			return ds.DataServiceVersion
+		}
+	}
+	return edmx.Version
+}
+
 type DataServices struct {
-	XMLName xml.Name  `xml:"DataServices"`
-	Schemas []*Schema `xml:"Schema"`
+	XMLName            xml.Name  `xml:"DataServices"`
+	DataServiceVersion string    `xml:"DataServiceVersion,attr,omitempty"`
+	Schemas            []*Schema `xml:"Schema"`
 }
 
 type Schema struct {
 	XMLName          xml.Name           `xml:"Schema"`
 	Namespace        string             `xml:"Namespace,attr"`
+	Alias            string             `xml:"Alias,attr,omitempty"`
 	XmlNs            string             `xml:"xmlns,attr"`
 	EntityTypes      []*EntityType      `xml:"EntityType"`
+	ComplexTypes     []*ComplexType     `xml:"ComplexType"`
+	EnumTypes        []*EnumType        `xml:"EnumType"`
+	TypeDefinitions  []*TypeDefinition  `xml:"TypeDefinition"`
+	Associations     []*Association     `xml:"Association"`
 	EntityContainers []*EntityContainer `xml:"EntityContainer"`
 }
 
-type EntityType struct {
-	XMLName    xml.Name    `xml:"EntityType"`
+// ComplexType is a structured type without key, the type of properties like an address
+type ComplexType struct {
+	XMLName    xml.Name    `xml:"ComplexType"`
 	Name       string      `xml:"Name,attr"`
-	Key        []*Key      `xml:"Key"`
 	Properties []*Property `xml:"Property"`
 }
 
+// EnumType is a type of named integer values. Members of flags enums can be combined, e.g. "Red,Blue".
+type EnumType struct {
+	XMLName        xml.Name      `xml:"EnumType"`
+	Name           string        `xml:"Name,attr"`
+	UnderlyingType string        `xml:"UnderlyingType,attr"`
+	IsFlags        bool          `xml:"IsFlags,attr"`
+	Members        []*EnumMember `xml:"Member"`
+}
+
+// EnumMember is a member of an enum type. Without value, members are numbered by position starting with 0.
+type EnumMember struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+// TypeDefinition is a named primitive type, e.g. a string restricted by facets. Its values are literals of the
+// underlying type.
+type TypeDefinition struct {
+	XMLName        xml.Name `xml:"TypeDefinition"`
+	Name           string   `xml:"Name,attr"`
+	UnderlyingType string   `xml:"UnderlyingType,attr"`
+}
+
+type EntityType struct {
+	XMLName              xml.Name              `xml:"EntityType"`
+	Name                 string                `xml:"Name,attr"`
+	BaseType             string                `xml:"BaseType,attr"`
+	Abstract             bool                  `xml:"Abstract,attr"`
+	Key                  []*Key                `xml:"Key"`
+	Properties           []*Property           `xml:"Property"`
+	NavigationProperties []*NavigationProperty `xml:"NavigationProperty"`
+}
+
 type Key struct {
 	XMLName     xml.Name       `xml:"Key"`
 	PropertyRef []*PropertyRef `xml:"PropertyRef"`
@@ -71,6 +269,33 @@ type Property struct {
 	Nullable string   `xml:"Nullable,attr"`
 }
 
+// NavigationProperty describes a relation to another entity type. V4 services declare the target in Type, e.g.
+// "NS.Customer" or "Collection(NS.Order)", V2 services refer to an Association via Relationship and ToRole.
+type NavigationProperty struct {
+	XMLName      xml.Name `xml:"NavigationProperty"`
+	Name         string   `xml:"Name,attr"`
+	Type         string   `xml:"Type,attr,omitempty"`
+	Nullable     string   `xml:"Nullable,attr,omitempty"`
+	Partner      string   `xml:"Partner,attr,omitempty"`
+	Relationship string   `xml:"Relationship,attr,omitempty"`
+	FromRole     string   `xml:"FromRole,attr,omitempty"`
+	ToRole       string   `xml:"ToRole,attr,omitempty"`
+}
+
+// Association is the V2 definition of a relation between two entity types
+type Association struct {
+	XMLName xml.Name          `xml:"Association"`
+	Name    string            `xml:"Name,attr"`
+	Ends    []*AssociationEnd `xml:"End"`
+}
+
+type AssociationEnd struct {
+	XMLName      xml.Name `xml:"End"`
+	Role         string   `xml:"Role,attr"`
+	Type         string   `xml:"Type,attr"`
+	Multiplicity string   `xml:"Multiplicity,attr"`
+}
+
 type EntityContainer struct {
 	XMLName   xml.Name     `xml:"EntityContainer"`
 	Name      string       `xml:"Name,attr"`
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// selectPath returns the path of a property of the entity type as expected by mapSelectExpand, which separates the
+// properties of complex types by "." and navigation properties by "/", e.g. "Customer/Address.City" for
+// "Customer/Address/City". From the first segment that is not found in the schema on, the path is kept as it is.
+func (s *schema) selectPath(entityType string, path string) string {
+	segments := strings.Split(path, "/")
+	result := segments[0]
+	typeName := entityType
+	for i, segment := range segments[:len(segments)-1] {
+		var separator string
+		typeName, separator = s.segmentType(typeName, segment)
+		if separator == "" {
+			return result + "/" + strings.Join(segments[i+1:], "/")
+		}
+		result += separator + segments[i+1]
+	}
+	return result
+}
+
+// segmentType returns the type of a complex or navigation property of the given entity or complex type and the
+// separator of the properties within it, or no separator if the property is neither
+func (s *schema) segmentType(typeName string, name string) (string, string) {
+	var properties []property
+	if et, ok := s.EntityTypes[typeName]; ok {
+		for _, np := range et.NavigationProperties {
+			if np.Name == name {
+				return np.EntityType, "/"
+			}
+		}
+		properties = et.Properties
+	} else if ct, ok := s.ComplexTypes[typeName]; ok {
+		properties = ct.Properties
+	}
+	for _, p := range properties {
+		if _, ok := s.ComplexTypes[p.Type]; ok && p.Name == name {
+			return p.Type, "."
+		}
+	}
+	return "", ""
+}
+
+// resolveSelectPaths tells the properties of complex types from the properties of related entities, which are both
+// selected by "/" separated paths like "Address/City". The metadata is only loaded if there are such paths.
+func (ds *ODataSource) resolveSelectPaths(ctx context.Context, instance *ODataSourceInstance, entitySet string,
+	properties []property) ([]property, error) {
+	if !slices.ContainsFunc(properties, func(p property) bool { return strings.Contains(p.Name, "/") }) {
+		return properties, nil
+	}
+	metadata, err := instance.metadata.get(ctx, instance.client, false)
+	if err != nil {
+		return nil, err
+	}
+	entityType := metadata.EntitySets[entitySet].EntityType
+	resolved := make([]property, len(properties))
+	for i, p := range properties {
+		resolved[i] = p
+		resolved[i].Name = metadata.selectPath(entityType, p.Name)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectPath(t *testing.T) {
+	metadata := temperatureSchema()
+	tables := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{name: "Property", path: "int32", expected: "int32"},
+		{name: "Complex property", path: "Address/City", expected: "Address.City"},
+		{name: "Nested complex property", path: "Address/Location/Floor", expected: "Address.Location.Floor"},
+		{name: "Dotted complex property", path: "Address.City", expected: "Address.City"},
+		{name: "Navigation property", path: "Sensor/Name", expected: "Sensor/Name"},
+		{name: "Nested navigation property", path: "Sensor/Room/Name", expected: "Sensor/Room/Name"},
+		{name: "Complex property of related entity", path: "Sensor/Address/City", expected: "Sensor/Address.City"},
+		{name: "Unknown property", path: "Unknown/Address/City", expected: "Unknown/Address/City"},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			path := metadata.selectPath("TemperatureODataMock.Models.Temperature", table.path)
+
+			// Assert
+			assert.Equal(t, table.expected, path)
+		})
+	}
+}
+
+func TestResolveSelectPaths(t *testing.T) {
+	// Arrange
+	metadata := temperatureSchema()
+	is := ODataSourceInstance{
+		client:   &clientMock{statusCode: 200},
+		metadata: &metadataCache{ttl: time.Hour, schema: &metadata, expires: time.Now().Add(time.Hour)},
+	}
+	ds := ODataSource{&managerMock{}}
+	properties := []property{{Name: "int32", Type: odata.EdmInt32}, {Name: "Address/City", Type: odata.EdmString},
+		{Name: "Sensor/Name", Type: odata.EdmString}}
+
+	// Act
+	resolved, err := ds.resolveSelectPaths(context.TODO(), &is, "Temperatures", properties)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []property{{Name: "int32", Type: odata.EdmInt32}, {Name: "Address.City", Type: odata.EdmString},
+		{Name: "Sensor/Name", Type: odata.EdmString}}, resolved)
+	assert.Equal(t, "Address/City", properties[1].Name)
+}
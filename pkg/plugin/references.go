@@ -0,0 +1,173 @@
+package plugin
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Upper bound of referenced documents loaded for a metadata document, including the documents they reference
+const maxReferencedDocuments = 50
+
+// referenceCache keeps the referenced metadata documents between loads of the metadata. Unlike the metadata document
+// they are not revalidated; they are only fetched again when the metadata is refreshed.
+type referenceCache struct {
+	mu        sync.Mutex
+	documents map[string]*odata.Edmx
+}
+
+func newReferenceCache() *referenceCache {
+	return &referenceCache{documents: make(map[string]*odata.Edmx)}
+}
+
+// get returns the cached document of the URI. A nil cache never has a document.
+func (c *referenceCache) get(uri string) (*odata.Edmx, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	document, ok := c.documents[uri]
+	return document, ok
+}
+
+func (c *referenceCache) put(uri string, document *odata.Edmx) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.documents[uri] = document
+}
+
+// loadReferences loads the documents referenced by the metadata document, and the documents they reference, and adds
+// their schemas and references to it. Each URI is loaded once, which also stops cycles. Documents that cannot be
+// loaded are skipped, as many references only point to vocabularies of annotations.
+func loadReferences(ctx context.Context, client ODataClient, edmx *odata.Edmx, cache *referenceCache) {
+	loaded := map[string]bool{odata.Metadata: true}
+	for i := 0; i < len(edmx.References); i++ {
+		uri := edmx.References[i].Uri
+		if uri == "" || loaded[uri] {
+			continue
+		}
+		if len(loaded) > maxReferencedDocuments {
+			log.DefaultLogger.Warn("Too many referenced metadata documents, skipping the rest", "uri", uri)
+			return
+		}
+		loaded[uri] = true
+		document, ok := cache.get(uri)
+		if !ok {
+			var err error
+			document, err = loadReference(ctx, client, uri)
+			if err != nil {
+				log.DefaultLogger.Debug("Skipping referenced metadata document", "uri", uri, "error", err)
+				continue
+			}
+			cache.put(uri, document)
+		}
+		edmx.References = append(edmx.References, document.References...)
+		edmx.DataServices = append(edmx.DataServices, document.DataServices...)
+	}
+}
+
+func loadReference(ctx context.Context, client ODataClient, uri string) (*odata.Edmx, error) {
+	resp, err := client.GetReference(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newResponseError("get referenced metadata", resp)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var document odata.Edmx
+	if err := xml.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// aliases maps the aliases of schemas and included namespaces to the namespaces
+type aliases map[string]string
+
+func newAliases(edmx odata.Edmx) aliases {
+	result := aliases{}
+	for _, reference := range edmx.References {
+		for _, include := range reference.Includes {
+			if include.Alias != "" {
+				result[include.Alias] = include.Namespace
+			}
+		}
+	}
+	for _, ds := range edmx.DataServices {
+		for _, s := range ds.Schemas {
+			if s.Alias != "" {
+				result[s.Alias] = s.Namespace
+			}
+		}
+	}
+	return result
+}
+
+// resolve replaces the alias of a qualified name by its namespace, e.g. "Self.Order" by "NS.Order", also within
+// collection types
+func (a aliases) resolve(name string) string {
+	if elementType, ok := odata.ElementType(name); ok {
+		return "Collection(" + a.resolve(elementType) + ")"
+	}
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return name
+	}
+	if namespace, ok := a[name[:i]]; ok {
+		return namespace + name[i:]
+	}
+	return name
+}
+
+// normalizeAliases replaces the aliases in all type references of the schemas by namespaces, so that types are only
+// known by their namespace qualified names
+func normalizeAliases(edmx odata.Edmx) {
+	a := newAliases(edmx)
+	if len(a) == 0 {
+		return
+	}
+	for _, ds := range edmx.DataServices {
+		for _, s := range ds.Schemas {
+			for _, et := range s.EntityTypes {
+				et.BaseType = a.resolve(et.BaseType)
+				for _, p := range et.Properties {
+					p.Type = a.resolve(p.Type)
+				}
+				for _, np := range et.NavigationProperties {
+					np.Type = a.resolve(np.Type)
+					np.Relationship = a.resolve(np.Relationship)
+				}
+			}
+			for _, ct := range s.ComplexTypes {
+				for _, p := range ct.Properties {
+					p.Type = a.resolve(p.Type)
+				}
+			}
+			for _, association := range s.Associations {
+				for _, end := range association.Ends {
+					end.Type = a.resolve(end.Type)
+				}
+			}
+			for _, ec := range s.EntityContainers {
+				for _, es := range ec.EntitySet {
+					es.EntityType = a.resolve(es.EntityType)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const referencingMetadata = `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="4.0" xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx">
+  <edmx:Reference Uri="common.xml">
+    <edmx:Include Namespace="Common" Alias="C"/>
+  </edmx:Reference>
+  <edmx:Reference Uri="https://vocabularies.example.com/Core.xml">
+    <edmx:Include Namespace="Org.OData.Core.V1" Alias="Core"/>
+  </edmx:Reference>
+  <edmx:DataServices>
+    <Schema Namespace="NS" Alias="Self" xmlns="http://docs.oasis-open.org/odata/ns/edm">
+      <EntityType Name="Order" BaseType="C.Entity">
+        <Property Name="Status" Type="C.Status"/>
+        <Property Name="Labels" Type="Collection(C.Label)"/>
+      </EntityType>
+      <EntityContainer Name="Container">
+        <EntitySet Name="Orders" EntityType="Self.Order"/>
+      </EntityContainer>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>`
+
+// The referenced document references itself and the referencing document
+const referencedMetadata = `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="4.0" xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx">
+  <edmx:Reference Uri="common.xml"><edmx:Include Namespace="Common"/></edmx:Reference>
+  <edmx:Reference Uri="$metadata"><edmx:Include Namespace="NS"/></edmx:Reference>
+  <edmx:DataServices>
+    <Schema Namespace="Common" xmlns="http://docs.oasis-open.org/odata/ns/edm">
+      <EntityType Name="Entity" Abstract="true">
+        <Key><PropertyRef Name="Id"/></Key>
+        <Property Name="Id" Type="Edm.Int32"/>
+      </EntityType>
+      <EnumType Name="Status"><Member Name="Open"/><Member Name="Closed"/></EnumType>
+      <ComplexType Name="Label"><Property Name="Text" Type="Edm.String"/></ComplexType>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>`
+
+// referenceServer serves the metadata and the referenced document and counts the requests per path
+type referenceServer struct {
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (s *referenceServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	s.mu.Unlock()
+	switch r.URL.Path {
+	case "/$metadata":
+		_, _ = w.Write([]byte(referencingMetadata))
+	case "/common.xml":
+		_, _ = w.Write([]byte(referencedMetadata))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestLoadMetadataReferences(t *testing.T) {
+	// Arrange
+	server := &referenceServer{requests: map[string]int{}}
+	client := GetOC("*", server.handle)
+
+	// Act
+	metadata, err := newMetadataCache(0).get(context.TODO(), client, false)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"/$metadata": 1, "/common.xml": 1}, server.requests)
+	assert.Equal(t, entitySet{Name: "Orders", EntityType: "NS.Order"}, metadata.EntitySets["Orders"])
+	order := metadata.EntityTypes["NS.Order"]
+	assert.Equal(t, "Common.Entity", order.BaseType)
+	assert.Equal(t, []string{"Id"}, order.Key)
+	assert.Equal(t, []property{
+		{Name: "Id", Type: odata.EdmInt32},
+		{Name: "Status", Type: "Common.Status"},
+		{Name: "Labels", Type: "Collection(Common.Label)"},
+	}, order.Properties)
+	assert.Contains(t, metadata.EnumTypes, "Common.Status")
+	assert.Contains(t, metadata.ComplexTypes, "Common.Label")
+}
+
+func TestLoadMetadataReferencesRequestLimit(t *testing.T) {
+	// Arrange
+	server := &referenceServer{requests: map[string]int{}}
+	GetOC("*", server.handle)
+	client := &ODataClientImpl{httpClient: oc.httpClient, baseUrl: oc.baseUrl, requests: make(chan struct{}, 1)}
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	// Act
+	metadata, err := newMetadataCache(0).get(ctx, client, false)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"/$metadata": 1, "/common.xml": 1}, server.requests)
+	assert.Contains(t, metadata.EnumTypes, "Common.Status")
+	assert.Empty(t, client.requests)
+}
+
+func TestLoadMetadataReferencesCached(t *testing.T) {
+	tables := []struct {
+		name               string
+		refresh            bool
+		expectedReferences int
+	}{
+		{
+			name:               "Revalidated",
+			expectedReferences: 1,
+		},
+		{
+			name:               "Refreshed",
+			refresh:            true,
+			expectedReferences: 2,
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			server := &referenceServer{requests: map[string]int{}}
+			client := GetOC("*", server.handle)
+			cache := newMetadataCache(-1)
+			_, err := cache.get(context.TODO(), client, false)
+			require.NoError(t, err)
+
+			// Act
+			metadata, err := cache.get(context.TODO(), client, table.refresh)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, 2, server.requests["/$metadata"])
+			assert.Equal(t, table.expectedReferences, server.requests["/common.xml"])
+			assert.Contains(t, metadata.EnumTypes, "Common.Status")
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	tables := []struct {
+		name             string
+		body             string
+		expectedEntities int
+		expectedNextLink string
+		expectedCount    *int64
+	}{
+		{
+			name: "V4",
+			body: `{"@odata.context":"$metadata#Temperatures","@odata.count":5,"value":[{"int32":1},` +
+				`{"int32":2,"nested":{"value":[1,2]}},{"int32":3}],"@odata.nextLink":"Temperatures?$skiptoken=3"}`,
+			expectedEntities: 3,
+			expectedNextLink: "Temperatures?$skiptoken=3",
+			expectedCount:    pointerTo(int64(5)),
+		},
+		{
+			name:             "V3 JSON light",
+			body:             `{"odata.metadata":"x","odata.count":"3","value":[{"int32":1}],"odata.nextLink":"next"}`,
+			expectedEntities: 1,
+			expectedNextLink: "next",
+			expectedCount:    pointerTo(int64(3)),
+		},
+		{
+			name: "V2",
+			body: `{"d":{"__count":"4","results":[{"__metadata":{"uri":"x"},"int32":1},{"int32":2}],` +
+				`"__next":"Temperatures?$skiptoken=2"}}`,
+			expectedEntities: 2,
+			expectedNextLink: "Temperatures?$skiptoken=2",
+			expectedCount:    pointerTo(int64(4)),
+		},
+		{
+			name:             "V1",
+			body:             `{"d":[{"int32":1},{"int32":2},{"int32":3},{"int32":4},{"int32":5}]}`,
+			expectedEntities: 5,
+		},
+		{
+			name: "No entities",
+			body: `{"value":null}`,
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			var entities []map[string]interface{}
+
+			// Act
+			result, err := odata.DecodeResponse(strings.NewReader(table.body),
+				entityMaps(func(entity map[string]interface{}) {
+					entities = append(entities, entity)
+				}))
+
+			// Assert
+			require.NoError(t, err)
+			assert.Len(t, entities, table.expectedEntities)
+			assert.Equal(t, table.expectedNextLink, result.NextLink)
+			assert.Equal(t, table.expectedCount, result.Count)
+		})
+	}
+}
+
+func TestDecodeResponseStops(t *testing.T) {
+	// Arrange
+	stop := errors.New("stop")
+	entities := 0
+
+	// Act
+	_, err := odata.DecodeResponse(strings.NewReader(`{"value":[{"a":1},{"a":2},{"a":3}`),
+		func(dec *json.Decoder) error {
+			entities++
+			return stop
+		})
+
+	// Assert
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, entities)
+}
+
+func TestDecodeResponseInvalid(t *testing.T) {
+	for _, body := range []string{``, `[]`, `{"value":{}}`, `{"value":[{"a":1}`} {
+		_, err := odata.DecodeResponse(strings.NewReader(body), entityMaps(func(map[string]interface{}) {}))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestDecodeEntity(t *testing.T) {
+	tables := []struct {
+		name     string
+		body     string
+		expected map[string]interface{}
+	}{
+		{
+			name: "Selected properties",
+			body: `{"@odata.etag":"W/\"1\"","int32":1,"skipped":{"nested":[1,{"a":[]}]},` +
+				`"Address":{"City":"Bonn"},"string":null}`,
+			expected: map[string]interface{}{
+				"int32":   json.Number("1"),
+				"Address": map[string]interface{}{"City": "Bonn"},
+				"string":  nil,
+			},
+		},
+		{
+			name:     "Null entity",
+			body:     `null`,
+			expected: map[string]interface{}{},
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			dec := json.NewDecoder(strings.NewReader(table.body))
+			dec.UseNumber()
+			properties := map[string]interface{}{}
+
+			// Act
+			err := odata.DecodeEntity(dec, func(name string) bool { return name != "skipped" && name[0] != '@' },
+				func(name string, value interface{}) { properties[name] = value })
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, table.expected, properties)
+			assert.False(t, dec.More())
+		})
+	}
+}
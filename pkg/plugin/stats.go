@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// redacted replaces credentials in executed query strings
+const redacted = "xxxxx"
+
+// sensitiveParameters are parts of query parameter names that indicate credentials, e.g. access_token or sig
+var sensitiveParameters = []string{"token", "key", "secret", "password", "sig", "auth"}
+
+// requestStats collects the executed request and the number of pages of a query, which are shown in the query
+// inspector
+type requestStats struct {
+	start time.Time
+	url   string
+	pages int
+}
+
+func newRequestStats() *requestStats {
+	return &requestStats{start: time.Now()}
+}
+
+// record counts a response page and remembers the URL of the first request
+func (stats *requestStats) record(resp *http.Response) {
+	if stats == nil {
+		return
+	}
+	stats.pages++
+	if stats.url == "" && resp != nil && resp.Request != nil && resp.Request.URL != nil {
+		stats.url = redactUrl(resp.Request.URL)
+	}
+}
+
+// apply sets the executed query string, the page count and the duration of the requests on the frames
+func (stats *requestStats) apply(frames ...*data.Frame) {
+	duration := time.Since(stats.start)
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.ExecutedQueryString = stats.url
+		frame.Meta.Stats = append(frame.Meta.Stats,
+			data.QueryStat{FieldConfig: data.FieldConfig{DisplayName: "Pages"}, Value: float64(stats.pages)},
+			data.QueryStat{FieldConfig: data.FieldConfig{DisplayName: "Request duration", Unit: "ms"},
+				Value: float64(duration.Milliseconds())})
+	}
+}
+
+// redactUrl hides the password of the URL and the values of query parameters that look like credentials. The other
+// parameters are kept as sent.
+func redactUrl(u *url.URL) string {
+	result := *u
+	if result.User != nil {
+		if _, ok := result.User.Password(); ok {
+			result.User = url.UserPassword(result.User.Username(), redacted)
+		}
+	}
+	if result.RawQuery != "" {
+		parts := strings.Split(result.RawQuery, "&")
+		for i, part := range parts {
+			key, _, hasValue := strings.Cut(part, "=")
+			name, err := url.QueryUnescape(key)
+			if err != nil || !hasValue || strings.HasPrefix(name, "$") {
+				continue
+			}
+			for _, sensitive := range sensitiveParameters {
+				if strings.Contains(strings.ToLower(name), sensitive) {
+					parts[i] = key + "=" + redacted
+					break
+				}
+			}
+		}
+		result.RawQuery = strings.Join(parts, "&")
+	}
+	return result.String()
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
@@ -203,7 +204,26 @@ func withRow(builders ...func(index int, f *data.Frame)) func(n *data.Frame) {
 	}
 }
 
-func withRowValue[T string | int32 | bool | time.Time](value T) func(index int, n *data.Frame) {
+// withoutRequestStats removes the executed query string and the request stats, which differ between runs, from the
+// frames
+func withoutRequestStats(frames data.Frames) {
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			continue
+		}
+		frame.Meta.ExecutedQueryString = ""
+		frame.Meta.Stats = nil
+		if reflect.DeepEqual(*frame.Meta, data.FrameMeta{}) {
+			frame.Meta = nil
+		}
+	}
+}
+
+func pointerTo[T any](value T) *T {
+	return &value
+}
+
+func withRowValue[T string | int32 | int64 | float64 | bool | time.Time | json.RawMessage](value T) func(index int, n *data.Frame) {
 	return func(index int, frame *data.Frame) {
 		frame.Fields[index].Append(&value)
 	}
@@ -352,6 +372,16 @@ func withProperty(name string, propertyType string) func(n *odata.EntityType) {
 	}
 }
 
+func withNavigationProperty(name string, navigationType string) func(n *odata.EntityType) {
+	return func(et *odata.EntityType) {
+		et.NavigationProperties = append(et.NavigationProperties, &odata.NavigationProperty{
+			XMLName: xml.Name{Space: "https://docs.oasis-open.org/odata/ns/edm", Local: "NavigationProperty"},
+			Name:    name,
+			Type:    navigationType,
+		})
+	}
+}
+
 func withKey(name string, builders ...func(*odata.Key)) func(n *odata.EntityType) {
 	return func(et *odata.EntityType) {
 		et.Key = append(et.Key, anOdataKey(name, builders...))
@@ -367,8 +397,12 @@ func withPropertyRef(name string) func(n *odata.Key) {
 // Metadata resource related
 func aSchema(builders ...func(*schema)) schema {
 	resource := schema{
-		EntityTypes: make(map[string]entityType),
-		EntitySets:  make(map[string]entitySet),
+		Version:         "4.0",
+		EntityTypes:     make(map[string]entityType),
+		ComplexTypes:    make(map[string]complexType),
+		EnumTypes:       make(map[string]enumType),
+		TypeDefinitions: make(map[string]string),
+		EntitySets:      make(map[string]entitySet),
 	}
 	for _, build := range builders {
 		build(&resource)
@@ -376,6 +410,28 @@ func aSchema(builders ...func(*schema)) schema {
 	return resource
 }
 
+// temperatureSchema returns the metadata of the default entity set of aQueryModel with a complex property and
+// related entities
+func temperatureSchema() schema {
+	return aSchema(
+		withEntitySetResource("Temperatures", "TemperatureODataMock.Models.Temperature"),
+		withEntityTypeResource("Temperature", "TemperatureODataMock.Models",
+			withPropertyResource("int32", odata.EdmInt32),
+			withPropertyResource("Address", "TemperatureODataMock.Models.Address"),
+			withNavigationPropertyResource("Sensor", "TemperatureODataMock.Models.Sensor", false)),
+		withEntityTypeResource("Sensor", "TemperatureODataMock.Models",
+			withPropertyResource("Name", odata.EdmString),
+			withPropertyResource("Address", "TemperatureODataMock.Models.Address"),
+			withNavigationPropertyResource("Room", "TemperatureODataMock.Models.Room", false)),
+		withEntityTypeResource("Room", "TemperatureODataMock.Models",
+			withPropertyResource("Name", odata.EdmString)),
+		withComplexTypeResource("Address", "TemperatureODataMock.Models",
+			property{Name: "City", Type: odata.EdmString},
+			property{Name: "Location", Type: "TemperatureODataMock.Models.Location"}),
+		withComplexTypeResource("Location", "TemperatureODataMock.Models",
+			property{Name: "Floor", Type: odata.EdmInt32}))
+}
+
 func anEntityType(name string, namespace string, builders ...func(*entityType)) *entityType {
 	et := &entityType{
 		Name:          name,
@@ -402,12 +458,32 @@ func withEntityTypeResource(name string, namespace string, builders ...func(*ent
 	}
 }
 
+func withComplexTypeResource(name string, namespace string, properties ...property) func(n *schema) {
+	return func(resource *schema) {
+		qualifiedName := fmt.Sprintf("%s.%s", namespace, name)
+		resource.ComplexTypes[qualifiedName] = complexType{Name: name, QualifiedName: qualifiedName,
+			Properties: properties}
+	}
+}
+
+func withSchemaVersion(version string) func(n *schema) {
+	return func(resource *schema) {
+		resource.Version = version
+	}
+}
+
 func withEntitySetResource(name string, entityType string) func(n *schema) {
 	return func(resource *schema) {
 		resource.EntitySets[name] = *anEntitySet(name, entityType)
 	}
 }
 
+func withKeyResource(names ...string) func(n *entityType) {
+	return func(et *entityType) {
+		et.Key = append(et.Key, names...)
+	}
+}
+
 func withPropertyResource(name string, propertyType string) func(n *entityType) {
 	return func(et *entityType) {
 		et.Properties = append(et.Properties, property{
@@ -417,6 +493,16 @@ func withPropertyResource(name string, propertyType string) func(n *entityType)
 	}
 }
 
+func withNavigationPropertyResource(name string, targetType string, collection bool) func(n *entityType) {
+	return func(et *entityType) {
+		et.NavigationProperties = append(et.NavigationProperties, navigationProperty{
+			Name:       name,
+			EntityType: targetType,
+			Collection: collection,
+		})
+	}
+}
+
 // --- Filter related ---
 func someFilterConditions(builders ...func(*filterCondition)) []filterCondition {
 	var conditions []filterCondition
@@ -446,6 +532,27 @@ func withFilterConditions(builders ...func(*filterCondition)) func(fs *queryMode
 	}
 }
 
+func withFilter(node *filterNode) func(n *queryModel) {
+	return func(model *queryModel) {
+		model.Filter = node
+	}
+}
+
+func withVariable(name string, values ...string) func(n *queryModel) {
+	return func(model *queryModel) {
+		if model.Variables == nil {
+			model.Variables = map[string][]string{}
+		}
+		model.Variables[name] = values
+	}
+}
+
+func withEntitySetName(name string) func(n *queryModel) {
+	return func(model *queryModel) {
+		model.EntitySet.Name = name
+	}
+}
+
 func withFilterCondition(property func(*property), operator string, val string) func(n *filterCondition) {
 	return func(condition *filterCondition) {
 		p := aProperty()
@@ -455,8 +562,44 @@ func withFilterCondition(property func(*property), operator string, val string)
 		condition.Value = val
 	}
 }
+func aConditionNode(builders ...func(*filterCondition)) *filterNode {
+	return &filterNode{Condition: aFilterCondition(builders...)}
+}
+
+func anAndGroup(children ...*filterNode) *filterNode {
+	return aFilterGroup(filterAnd, children...)
+}
+
+func anOrGroup(children ...*filterNode) *filterNode {
+	return aFilterGroup(filterOr, children...)
+}
+
+func aFilterGroup(operator string, children ...*filterNode) *filterNode {
+	group := &filterNode{Operator: operator}
+	for _, child := range children {
+		group.Children = append(group.Children, *child)
+	}
+	return group
+}
+
+func negated(node *filterNode) *filterNode {
+	node.Not = true
+	return node
+}
+
+func caseInsensitive(condition *filterCondition) {
+	condition.CaseInsensitive = true
+}
+
+func withValues(values ...string) func(n *filterCondition) {
+	return func(condition *filterCondition) {
+		condition.Values = values
+	}
+}
+
 func int32Eq5(condition *filterCondition) {
 	condition.Property.Name = "int32"
+	condition.Property.Type = odata.EdmInt32
 	condition.Operator = "eq"
 	condition.Value = "5"
 }
@@ -526,6 +669,18 @@ func int32Prop(p *property) {
 	p.Name = "int32"
 	p.Type = odata.EdmInt32
 }
+func int64Prop(p *property) {
+	p.Name = "int64"
+	p.Type = odata.EdmInt64
+}
+func decimalProp(p *property) {
+	p.Name = "decimal"
+	p.Type = odata.EdmDecimal
+}
+func dateProp(p *property) {
+	p.Name = "date"
+	p.Type = odata.EdmDate
+}
 func booleanProp(p *property) {
 	p.Name = "boolean"
 	p.Type = odata.EdmBoolean
@@ -534,10 +689,155 @@ func stringProp(p *property) {
 	p.Name = "string"
 	p.Type = odata.EdmString
 }
+func cityProp(p *property) {
+	p.Name = "Address/City"
+	p.Type = odata.EdmString
+}
 func timeProp(p *property) {
 	p.Name = "time"
 	p.Type = odata.EdmDateTimeOffset
 }
+func dateTimeProp(p *property) {
+	p.Name = "datetime"
+	p.Type = odata.EdmDateTime
+}
+func guidProp(p *property) {
+	p.Name = "guid"
+	p.Type = odata.EdmGuid
+}
+
+// --- Aggregation related ---
+func anAggregation(builders ...func(*aggregation)) aggregation {
+	agg := aggregation{}
+	for _, build := range builders {
+		build(&agg)
+	}
+	return agg
+}
+
+func withAggregation(builders ...func(*aggregation)) func(n *queryModel) {
+	return func(model *queryModel) {
+		agg := anAggregation(builders...)
+		model.Aggregation = &agg
+	}
+}
+
+func withGroupBy(builders ...func(*property)) func(n *aggregation) {
+	return func(agg *aggregation) {
+		for _, build := range builders {
+			agg.GroupBy = append(agg.GroupBy, aProperty(build))
+		}
+	}
+}
+
+func withAggregate(prop func(*property), method string, alias string) func(n *aggregation) {
+	return func(agg *aggregation) {
+		a := aggregate{Method: method, Alias: alias}
+		if prop != nil {
+			a.Property = aProperty(prop)
+		}
+		agg.Aggregates = append(agg.Aggregates, a)
+	}
+}
+
+func withTimeBucket(bucket string) func(n *aggregation) {
+	return func(agg *aggregation) {
+		agg.TimeBucket = bucket
+	}
+}
+
+// withBucketParts adds the date parts computed for an hourly bucket of the time property to an aggregated entity
+func withBucketParts(start time.Time) func(e map[string]interface{}) {
+	return func(e map[string]interface{}) {
+		e["time_year"] = float64(start.Year())
+		e["time_month"] = float64(start.Month())
+		e["time_day"] = float64(start.Day())
+		e["time_hour"] = float64(start.Hour())
+	}
+}
+
+func aTimeSeriesFrame(refId string, labels data.Labels, times []time.Time, values []float64) *data.Frame {
+	var pointers []*float64
+	for i := range values {
+		pointers = append(pointers, &values[i])
+	}
+	frame := data.NewFrame(refId,
+		data.NewField("time", nil, times),
+		data.NewField("int32_sum", labels, pointers))
+	frame.Meta = &data.FrameMeta{
+		Type:                   data.FrameTypeTimeSeriesMulti,
+		TypeVersion:            data.FrameTypeVersion{0, 1},
+		PreferredVisualization: data.VisTypeGraph,
+	}
+	return frame
+}
+
+func withOrderBy(prop func(*property), direction string) func(n *queryModel) {
+	return func(model *queryModel) {
+		model.OrderBy = append(model.OrderBy, orderBy{Property: aProperty(prop), Direction: direction})
+	}
+}
+
+func withTop(top int64) func(n *queryModel) {
+	return func(model *queryModel) {
+		model.Top = top
+	}
+}
+
+func withExplode(name string) func(n *queryModel) {
+	return func(model *queryModel) {
+		model.Explode = name
+	}
+}
+
+func tagsProp(p *property) {
+	p.Name = "Tags"
+	p.Type = "Collection(Edm.String)"
+}
+
+// withAnnotation maps the given string properties to the annotation fields, empty names are not mapped
+func withAnnotation(timeEnd string, title string, text string, tags ...string) func(n *queryModel) {
+	return func(model *queryModel) {
+		a := &annotation{}
+		model.Annotation = a
+		if timeEnd != "" {
+			a.TimeEndProperty = &property{Name: timeEnd, Type: odata.EdmDateTimeOffset}
+		}
+		if title != "" {
+			a.TitleProperty = &property{Name: title, Type: odata.EdmString}
+		}
+		if text != "" {
+			a.TextProperty = &property{Name: text, Type: odata.EdmString}
+		}
+		for _, tag := range tags {
+			a.TagProperties = append(a.TagProperties, property{Name: tag, Type: odata.EdmString})
+		}
+	}
+}
+
+func withQueryType(queryType string) func(n *backend.DataQuery) {
+	return func(query *backend.DataQuery) {
+		query.QueryType = queryType
+	}
+}
+
+func withInterval(interval time.Duration) func(n *backend.DataQuery) {
+	return func(query *backend.DataQuery) {
+		query.Interval = interval
+	}
+}
+
+func withMaxDataPoints(maxDataPoints int64) func(n *backend.DataQuery) {
+	return func(query *backend.DataQuery) {
+		query.MaxDataPoints = maxDataPoints
+	}
+}
+
+func withTimeRange(duration time.Duration) func(n *backend.DataQuery) {
+	return func(query *backend.DataQuery) {
+		query.TimeRange.To = query.TimeRange.From.Add(duration)
+	}
+}
 
 // Misc
 func aOneDayTimeRange() backend.TimeRange {
@@ -47,5 +47,7 @@ func TestMain(m *testing.M) {
 func GetOC(hp string, h func(w http.ResponseWriter, r *http.Request)) ODataClient {
 	handler = h
 	handlerPath = hp
+	// Forget the OData version detected by previous tests
+	oc.version = ""
 	return &oc
 }
@@ -0,0 +1,412 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const timeBucketAuto = "auto"
+
+// timeBucket groups entities server-side by the date parts of the time property, e.g. year, month and day for daily
+// buckets. The date parts are computed via compute(year(Time) as Time_year, ...).
+type timeBucket struct {
+	Property   property
+	Components []string
+}
+
+func (bucket *timeBucket) alias(component string) string {
+	return aliasName(bucket.Property.Name) + "_" + component
+}
+
+// start returns the start of the bucket from the computed date parts of an aggregated entity
+func (bucket *timeBucket) start(entity map[string]interface{}) (time.Time, bool) {
+	parts := map[string]int{"month": 1, "day": 1}
+	for _, component := range bucket.Components {
+		value, ok := odata.MapValue(entity[bucket.alias(component)], odata.EdmInt32).(*int32)
+		if !ok || value == nil {
+			return time.Time{}, false
+		}
+		parts[component] = int(*value)
+	}
+	return time.Date(parts["year"], time.Month(parts["month"]), parts["day"], parts["hour"], parts["minute"], 0, 0,
+		time.UTC), true
+}
+
+// bucketInterval returns the width of the time buckets, either the query interval or the configured duration. It is
+// widened where necessary so that the time range is covered by at most MaxDataPoints buckets.
+func bucketInterval(query backend.DataQuery, bucket string) (time.Duration, error) {
+	interval := query.Interval
+	if bucket != timeBucketAuto {
+		duration, err := gtime.ParseDuration(bucket)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time bucket %q: %w", bucket, err)
+		}
+		interval = duration
+	}
+	if query.MaxDataPoints > 0 {
+		maxDataPoints := time.Duration(query.MaxDataPoints)
+		if minInterval := (query.TimeRange.Duration() + maxDataPoints - 1) / maxDataPoints; interval < minInterval {
+			interval = minInterval
+		}
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return interval, nil
+}
+
+// serverBucketComponents returns the date parts to group by server-side for buckets of exactly one minute, hour or
+// day. Other intervals can't be expressed with the OData date functions and are bucketed client-side.
+func serverBucketComponents(interval time.Duration) []string {
+	switch interval {
+	case time.Minute:
+		return []string{"year", "month", "day", "hour", "minute"}
+	case time.Hour:
+		return []string{"year", "month", "day", "hour"}
+	case 24 * time.Hour:
+		return []string{"year", "month", "day"}
+	default:
+		return nil
+	}
+}
+
+// queryTimeBuckets aggregates per time bucket and group, returning one time series per group and aggregate. Buckets
+// of whole calendar units are aggregated by the service via $apply; if it does not support this, or for other
+// intervals, the entities are fetched and aggregated by the plugin.
+func (ds *ODataSource) queryTimeBuckets(ctx context.Context, instance *ODataSourceInstance, query backend.DataQuery,
+	qm queryModel) backend.DataResponse {
+	response := backend.DataResponse{}
+	if qm.TimeProperty == nil {
+		response.Error = fmt.Errorf("time bucketing requires a time property")
+		return response
+	}
+	if len(qm.Aggregation.Aggregates) == 0 {
+		response.Error = fmt.Errorf("time bucketing requires at least one aggregate")
+		return response
+	}
+	interval, err := bucketInterval(query, qm.Aggregation.TimeBucket)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+	filterConditions := append(qm.FilterConditions, TimeRangeToFilter(query.TimeRange, qm.TimeProperty)...)
+
+	var series *timeSeriesBuilder
+	var notice *data.Notice
+	stats := newRequestStats()
+	if components := serverBucketComponents(interval); components != nil {
+		series = newTimeSeriesBuilder(query.RefID, qm.TimeProperty.Name, qm.Aggregation)
+		bucket := &timeBucket{Property: *qm.TimeProperty, Components: components}
+		notice, err = ds.readServerBuckets(ctx, instance, qm, bucket, filterConditions, series, stats)
+		if err != nil {
+			if ctx.Err() != nil {
+				response.Error = err
+				return response
+			}
+			log.DefaultLogger.Debug("Server-side time bucketing failed, falling back to client-side bucketing",
+				"error", err)
+			series = nil
+		}
+	}
+	if series == nil {
+		series = newTimeSeriesBuilder(query.RefID, qm.TimeProperty.Name, qm.Aggregation)
+		stats = newRequestStats()
+		notice, err = ds.readClientBuckets(ctx, instance, qm, interval, filterConditions, series, stats)
+		if err != nil {
+			response.Error = err
+			return response
+		}
+	}
+
+	response.Frames = series.frames()
+	stats.apply(response.Frames...)
+	if notice != nil {
+		response.Frames[0].AppendNotices(*notice)
+	}
+	return response
+}
+
+func (ds *ODataSource) readServerBuckets(ctx context.Context, instance *ODataSourceInstance, qm queryModel,
+	bucket *timeBucket, filterConditions []filterCondition, series *timeSeriesBuilder,
+	stats *requestStats) (*data.Notice, error) {
+	resp, err := instance.client.Get(ctx, qm.EntitySet.Name, queryOptions{
+		FilterConditions: filterConditions,
+		Filter:           qm.Filter,
+		Search:           qm.Search,
+		Aggregation:      qm.Aggregation,
+		TimeBucket:       bucket,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ds.readPages(ctx, instance, resp, stats, entityMaps(func(entity map[string]interface{}) {
+		start, ok := bucket.start(entity)
+		if !ok {
+			return
+		}
+		values := make([]interface{}, len(qm.Aggregation.Aggregates))
+		for i, a := range qm.Aggregation.Aggregates {
+			value, _ := odata.LookupValue(entity, a.alias())
+			values[i] = odata.MapValue(value, a.resultType())
+		}
+		series.add(groupLabels(qm.Aggregation.GroupBy, entity), start, values)
+	}))
+}
+
+func (ds *ODataSource) readClientBuckets(ctx context.Context, instance *ODataSourceInstance, qm queryModel,
+	interval time.Duration, filterConditions []filterCondition, series *timeSeriesBuilder,
+	stats *requestStats) (*data.Notice, error) {
+	props := append([]property{*qm.TimeProperty}, qm.Aggregation.GroupBy...)
+	for _, a := range qm.Aggregation.Aggregates {
+		if method, _ := a.method(); method != odata.AggregateCount {
+			props = append(props, a.Property)
+		}
+	}
+	props, err := ds.resolveSelectPaths(ctx, instance, qm.EntitySet.Name, uniqueProperties(props))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := instance.client.Get(ctx, qm.EntitySet.Name, queryOptions{
+		Properties:       props,
+		FilterConditions: filterConditions,
+		Filter:           qm.Filter,
+		Search:           qm.Search,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type groupBuckets struct {
+		labels  data.Labels
+		buckets map[time.Time]*bucketAccumulator
+	}
+	var keys []string
+	groups := make(map[string]*groupBuckets)
+	notice, err := ds.readPages(ctx, instance, resp, stats, entityMaps(func(entity map[string]interface{}) {
+		value, _ := odata.LookupValue(entity, qm.TimeProperty.Name)
+		timestamp, ok := odata.MapValue(value, qm.TimeProperty.Type).(*time.Time)
+		if !ok || timestamp == nil {
+			return
+		}
+		labels := groupLabels(qm.Aggregation.GroupBy, entity)
+		key := labels.String()
+		group, ok := groups[key]
+		if !ok {
+			group = &groupBuckets{labels: labels, buckets: make(map[time.Time]*bucketAccumulator)}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		start := timestamp.UTC().Truncate(interval)
+		acc, ok := group.buckets[start]
+		if !ok {
+			acc = newBucketAccumulator(len(qm.Aggregation.Aggregates))
+			group.buckets[start] = acc
+		}
+		acc.add(qm.Aggregation.Aggregates, entity)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		for start, acc := range group.buckets {
+			series.add(group.labels, start, acc.values(qm.Aggregation.Aggregates))
+		}
+	}
+	return notice, nil
+}
+
+// groupLabels returns the values of the grouping properties of an entity as series labels
+func groupLabels(groupBy []property, entity map[string]interface{}) data.Labels {
+	if len(groupBy) == 0 {
+		return nil
+	}
+	labels := data.Labels{}
+	for _, p := range groupBy {
+		value, ok := odata.LookupValue(entity, p.Name)
+		if ok && value != nil {
+			labels[p.Name] = fmt.Sprint(value)
+		} else {
+			labels[p.Name] = ""
+		}
+	}
+	return labels
+}
+
+func uniqueProperties(properties []property) []property {
+	var result []property
+	seen := make(map[string]bool)
+	for _, p := range properties {
+		if !seen[p.Name] {
+			seen[p.Name] = true
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// bucketAccumulator aggregates the entities of one time bucket and group client-side
+type bucketAccumulator struct {
+	entities int
+	counts   []int
+	sums     []float64
+	mins     []float64
+	maxs     []float64
+	distinct []map[string]struct{}
+}
+
+func newBucketAccumulator(aggregates int) *bucketAccumulator {
+	acc := &bucketAccumulator{
+		counts:   make([]int, aggregates),
+		sums:     make([]float64, aggregates),
+		mins:     make([]float64, aggregates),
+		maxs:     make([]float64, aggregates),
+		distinct: make([]map[string]struct{}, aggregates),
+	}
+	for i := range acc.distinct {
+		acc.distinct[i] = make(map[string]struct{})
+	}
+	return acc
+}
+
+func (acc *bucketAccumulator) add(aggregates []aggregate, entity map[string]interface{}) {
+	acc.entities++
+	for i, a := range aggregates {
+		value, ok := odata.LookupValue(entity, a.Property.Name)
+		if !ok || value == nil {
+			continue
+		}
+		acc.distinct[i][fmt.Sprint(value)] = struct{}{}
+		number, ok := odata.MapValue(value, odata.EdmDouble).(*float64)
+		if !ok || number == nil {
+			continue
+		}
+		if acc.counts[i] == 0 || *number < acc.mins[i] {
+			acc.mins[i] = *number
+		}
+		if acc.counts[i] == 0 || *number > acc.maxs[i] {
+			acc.maxs[i] = *number
+		}
+		acc.sums[i] += *number
+		acc.counts[i]++
+	}
+}
+
+// values returns the aggregated values mapped to the result types of the aggregates
+func (acc *bucketAccumulator) values(aggregates []aggregate) []interface{} {
+	values := make([]interface{}, len(aggregates))
+	for i, a := range aggregates {
+		var value interface{}
+		method, _ := a.method()
+		switch method {
+		case odata.AggregateCount:
+			value = float64(acc.entities)
+		case odata.AggregateCountDistinct:
+			value = float64(len(acc.distinct[i]))
+		case odata.AggregateSum:
+			if acc.counts[i] > 0 {
+				value = acc.sums[i]
+			}
+		case odata.AggregateAverage:
+			if acc.counts[i] > 0 {
+				value = acc.sums[i] / float64(acc.counts[i])
+			}
+		case odata.AggregateMin:
+			if acc.counts[i] > 0 {
+				value = acc.mins[i]
+			}
+		case odata.AggregateMax:
+			if acc.counts[i] > 0 {
+				value = acc.maxs[i]
+			}
+		}
+		values[i] = odata.MapValue(value, a.resultType())
+	}
+	return values
+}
+
+// timeSeriesBuilder collects the aggregated values per group and time bucket and builds the frames of the
+// time series multi format: one frame per group and aggregate with the group as labels of the value field
+type timeSeriesBuilder struct {
+	refID    string
+	timeName string
+	agg      *aggregation
+	keys     []string
+	series   map[string]*timeSeries
+}
+
+type timeSeries struct {
+	labels data.Labels
+	times  []time.Time
+	values [][]interface{}
+}
+
+func newTimeSeriesBuilder(refID string, timeName string, agg *aggregation) *timeSeriesBuilder {
+	return &timeSeriesBuilder{
+		refID:    refID,
+		timeName: timeName,
+		agg:      agg,
+		series:   make(map[string]*timeSeries),
+	}
+}
+
+func (builder *timeSeriesBuilder) add(labels data.Labels, start time.Time, values []interface{}) {
+	key := labels.String()
+	series, ok := builder.series[key]
+	if !ok {
+		series = &timeSeries{labels: labels}
+		builder.series[key] = series
+		builder.keys = append(builder.keys, key)
+	}
+	series.times = append(series.times, start)
+	series.values = append(series.values, values)
+}
+
+func (builder *timeSeriesBuilder) frames() data.Frames {
+	var frames data.Frames
+	for _, key := range builder.keys {
+		series := builder.series[key]
+		order := make([]int, len(series.times))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return series.times[order[i]].Before(series.times[order[j]]) })
+
+		for i, a := range builder.agg.Aggregates {
+			timeField := data.NewField(builder.timeName, nil, []time.Time{})
+			valueField := data.NewField(a.alias(), series.labels, odata.ToArray(a.resultType()))
+			for _, row := range order {
+				timeField.Append(series.times[row])
+				valueField.Append(series.values[row][i])
+			}
+			frames = append(frames, builder.newFrame(timeField, valueField))
+		}
+	}
+	if len(frames) == 0 {
+		// Typed but empty frames signal "no data" to the panels
+		for _, a := range builder.agg.Aggregates {
+			frames = append(frames, builder.newFrame(data.NewField(builder.timeName, nil, []time.Time{}),
+				data.NewField(a.alias(), nil, odata.ToArray(a.resultType()))))
+		}
+	}
+	return frames
+}
+
+func (builder *timeSeriesBuilder) newFrame(fields ...*data.Field) *data.Frame {
+	frame := data.NewFrame(builder.refID, fields...)
+	frame.Meta = &data.FrameMeta{
+		Type:                   data.FrameTypeTimeSeriesMulti,
+		TypeVersion:            data.FrameTypeVersion{0, 1},
+		PreferredVisualization: data.VisTypeGraph,
+	}
+	return frame
+}
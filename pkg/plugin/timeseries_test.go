@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketInterval(t *testing.T) {
+	tables := []struct {
+		name     string
+		bucket   string
+		query    backend.DataQuery
+		expected time.Duration
+	}{
+		{
+			name:     "Query interval",
+			bucket:   "auto",
+			query:    aDataQuery("A", withInterval(time.Minute), withTimeRange(time.Hour), withMaxDataPoints(100)),
+			expected: time.Minute,
+		},
+		{
+			name:     "Configured bucket",
+			bucket:   "1d",
+			query:    aDataQuery("A", withInterval(time.Minute), withTimeRange(7*24*time.Hour), withMaxDataPoints(100)),
+			expected: 24 * time.Hour,
+		},
+		{
+			name:     "Limited by max data points",
+			bucket:   "1m",
+			query:    aDataQuery("A", withInterval(time.Minute), withTimeRange(24*time.Hour), withMaxDataPoints(100)),
+			expected: 864 * time.Second,
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			interval, err := bucketInterval(table.query, table.bucket)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, table.expected, interval)
+		})
+	}
+}
+
+func TestQueryTimeBuckets(t *testing.T) {
+	from := time.Date(2022, 4, 21, 0, 0, 0, 0, time.UTC)
+	rawEntities := anOdataResponse(
+		withEntity(withProp("time", "2022-04-21T00:10:00Z"), withProp("string", "A"), withProp("int32", 1.0)),
+		withEntity(withProp("time", "2022-04-21T00:50:00Z"), withProp("string", "A"), withProp("int32", 3.0)),
+		withEntity(withProp("time", "2022-04-21T01:20:00Z"), withProp("string", "A"), withProp("int32", 5.0)),
+		withEntity(withProp("time", "2022-04-21T00:30:00Z"), withProp("string", "B"), withProp("int32", 7.0)))
+	hourly := data.Frames{
+		aTimeSeriesFrame("A", data.Labels{"string": "A"}, []time.Time{from, from.Add(time.Hour)}, []float64{4, 5}),
+		aTimeSeriesFrame("A", data.Labels{"string": "B"}, []time.Time{from}, []float64{7}),
+	}
+
+	tables := []struct {
+		name          string
+		bucket        string
+		handler       func(w http.ResponseWriter, r *http.Request)
+		expectedApply string
+		expected      data.Frames
+	}{
+		{
+			name:   "Server-side",
+			bucket: "1h",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				body, _ := json.Marshal(anOdataResponse(
+					withEntity(withBucketParts(from.Add(time.Hour)), withProp("string", "A"), withProp("int32_sum", 5.0)),
+					withEntity(withBucketParts(from), withProp("string", "A"), withProp("int32_sum", 4.0)),
+					withEntity(withBucketParts(from), withProp("string", "B"), withProp("int32_sum", 7.0))))
+				_, _ = w.Write(body)
+			},
+			expectedApply: "filter(time ge 2022-04-21T00:00:00Z and time le 2022-04-21T02:00:00Z)/" +
+				"compute(year(time) as time_year,month(time) as time_month,day(time) as time_day," +
+				"hour(time) as time_hour)/groupby((time_year,time_month,time_day,time_hour,string)," +
+				"aggregate(int32 with sum as int32_sum))",
+			expected: hourly,
+		},
+		{
+			name:   "Server-side not supported",
+			bucket: "1h",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Has(odata.Apply) {
+					w.WriteHeader(http.StatusNotImplemented)
+					return
+				}
+				body, _ := json.Marshal(rawEntities)
+				_, _ = w.Write(body)
+			},
+			expected: hourly,
+		},
+		{
+			name:   "Client-side",
+			bucket: "auto",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				body, _ := json.Marshal(rawEntities)
+				_, _ = w.Write(body)
+			},
+			// 30 minute buckets
+			expected: data.Frames{
+				aTimeSeriesFrame("A", data.Labels{"string": "A"},
+					[]time.Time{from, from.Add(30 * time.Minute), from.Add(time.Hour)}, []float64{1, 3, 5}),
+				aTimeSeriesFrame("A", data.Labels{"string": "B"}, []time.Time{from.Add(30 * time.Minute)},
+					[]float64{7}),
+			},
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Arrange
+			var requestedApply string
+			client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/" {
+					requestedApply = r.URL.Query().Get(odata.Apply)
+				}
+				table.handler(w, r)
+			})
+			is := ODataSourceInstance{client: client}
+			ds := ODataSource{&managerMock{}}
+			query := aDataQuery("A", withQueryType(queryTypeAggregation), withInterval(30*time.Minute),
+				withQueryModel(withTimeProperty("time"),
+					withAggregation(withGroupBy(stringProp), withAggregate(int32Prop, "sum", ""),
+						withTimeBucket(table.bucket))))
+			query.TimeRange = backend.TimeRange{From: from, To: from.Add(2 * time.Hour)}
+
+			// Act
+			resp := ds.query(context.TODO(), &is, query)
+			withoutRequestStats(resp.Frames)
+
+			// Assert
+			assert.NoError(t, resp.Error)
+			if table.expectedApply != "" {
+				assert.Equal(t, table.expectedApply, requestedApply)
+			}
+			assert.Equal(t, table.expected, resp.Frames)
+		})
+	}
+}
+
+func TestQueryTimeBucketsWithoutTimeProperty(t *testing.T) {
+	// Arrange
+	client := clientMock{statusCode: 200}
+	is := ODataSourceInstance{client: &client}
+	ds := ODataSource{&managerMock{}}
+	query := aDataQuery("A", withQueryType(queryTypeAggregation), withQueryModel(
+		withAggregation(withAggregate(int32Prop, "sum", ""), withTimeBucket("auto"))))
+
+	// Act
+	resp := ds.query(context.TODO(), &is, query)
+
+	// Assert
+	assert.ErrorContains(t, resp.Error, "time bucketing requires a time property")
+}
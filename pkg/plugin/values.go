@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// maxDistinctValueRows limits the entities read to collect distinct values if the service does not support grouping
+const maxDistinctValueRows = 10000
+
+// distinctValuesRequest is the body of the "values" resource, which provides the values of template variables
+type distinctValuesRequest struct {
+	EntitySet string      `json:"entitySet"`
+	Property  property    `json:"property"`
+	Filter    *filterNode `json:"filter,omitempty"`
+}
+
+func (ds *ODataSource) getDistinctValues(ctx context.Context, req *backend.CallResourceRequest,
+	sender backend.CallResourceResponseSender) error {
+	var request distinctValuesRequest
+	if err := json.Unmarshal(req.Body, &request); err != nil || request.EntitySet == "" ||
+		request.Property.Name == "" {
+		return sender.Send(&backend.CallResourceResponse{
+			Status: http.StatusBadRequest,
+			Body:   []byte("entity set and property are required"),
+		})
+	}
+	instance, err := ds.getInstance(ctx, req.PluginContext)
+	if err != nil {
+		return err
+	}
+	values, err := ds.distinctValues(ctx, instance, request)
+	if err != nil {
+		return err
+	}
+	responseBody, err := json.Marshal(values)
+	if err != nil {
+		log.DefaultLogger.Error("error marshalling response body")
+		return err
+	}
+	return sender.Send(&backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   responseBody,
+	})
+}
+
+// distinctValues returns the sorted distinct values of a property. The values are grouped by the service via
+// $apply=groupby((Property)). Services without support for aggregation are queried via $select, limited to
+// maxDistinctValueRows entities, and the values are deduplicated here.
+func (ds *ODataSource) distinctValues(ctx context.Context, instance *ODataSourceInstance,
+	request distinctValuesRequest) ([]string, error) {
+	if err := ds.resolveFilterTypes(ctx, instance, nil, request.Filter); err != nil {
+		return nil, err
+	}
+	options := queryOptions{
+		Filter:      request.Filter,
+		Aggregation: &aggregation{GroupBy: []property{request.Property}},
+	}
+	values, err := ds.readDistinctValues(ctx, instance, request, options)
+	if err == nil || ctx.Err() != nil {
+		return values, err
+	}
+	log.DefaultLogger.Debug("Grouping failed, falling back to client-side deduplication", "error", err)
+
+	capped := *instance
+	if capped.settings.MaxRows <= 0 || capped.settings.MaxRows > maxDistinctValueRows {
+		capped.settings.MaxRows = maxDistinctValueRows
+	}
+	options.Aggregation = nil
+	options.Properties, err = ds.resolveSelectPaths(ctx, instance, request.EntitySet, []property{request.Property})
+	if err != nil {
+		return nil, err
+	}
+	return ds.readDistinctValues(ctx, &capped, request, options)
+}
+
+func (ds *ODataSource) readDistinctValues(ctx context.Context, instance *ODataSourceInstance,
+	request distinctValuesRequest, options queryOptions) ([]string, error) {
+	resp, err := instance.client.Get(ctx, request.EntitySet, options)
+	if err != nil {
+		return nil, err
+	}
+	distinct := make(map[string]struct{})
+	notice, err := ds.readPages(ctx, instance, resp, nil, entityMaps(func(entity map[string]interface{}) {
+		value, ok := odata.LookupValue(entity, request.Property.Name)
+		if !ok {
+			return
+		}
+		if text, ok := formatValue(odata.MapValue(value, request.Property.Type)); ok {
+			distinct[text] = struct{}{}
+		}
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if notice != nil {
+		log.DefaultLogger.Warn("Distinct values are incomplete", "notice", notice.Text)
+	}
+	values := make([]string, 0, len(distinct))
+	for value := range distinct {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		// Numbers are sorted by value
+		a, errA := strconv.ParseFloat(values[i], 64)
+		b, errB := strconv.ParseFloat(values[j], 64)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return values[i] < values[j]
+	})
+	return values, nil
+}
+
+// formatValue formats a mapped property value as variable value, null values are skipped
+func formatValue(value interface{}) (string, bool) {
+	if t, ok := value.(*time.Time); ok && t != nil {
+		return t.Format(time.RFC3339Nano), true
+	}
+	if raw, ok := value.(*json.RawMessage); ok && raw != nil {
+		return string(*raw), true
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return "", false
+	}
+	return fmt.Sprint(reflect.Indirect(v).Interface()), true
+}
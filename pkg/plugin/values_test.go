@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistinctValues(t *testing.T) {
+	// Arrange
+	var requestedApply string
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		requestedApply = r.URL.Query().Get(odata.Apply)
+		body, _ := json.Marshal(anOdataResponse(
+			withEntity(withProp("string", "B")),
+			withEntity(withProp("string", "A")),
+			withEntity(withProp("string", nil))))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	})
+	is := ODataSourceInstance{client: client}
+	ds := ODataSource{&managerMock{}}
+	request := distinctValuesRequest{
+		EntitySet: "Temperatures",
+		Property:  property{Name: "string", Type: odata.EdmString},
+		Filter:    aConditionNode(int32Eq5),
+	}
+
+	// Act
+	values, err := ds.distinctValues(context.TODO(), &is, request)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "filter(int32 eq 5)/groupby((string))", requestedApply)
+	assert.Equal(t, []string{"A", "B"}, values)
+}
+
+func TestDistinctValuesWithoutGrouping(t *testing.T) {
+	// Arrange
+	var requestedSelect string
+	client := GetOC("*", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get(odata.Apply) != "" {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		requestedSelect = r.URL.Query().Get(odata.Select)
+		body, _ := json.Marshal(anOdataResponse(
+			withEntity(withProp("int32", 10.0)),
+			withEntity(withProp("int32", 2.0)),
+			withEntity(withProp("int32", 10.0))))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	})
+	is := ODataSourceInstance{client: client}
+	ds := ODataSource{&managerMock{}}
+	request := distinctValuesRequest{
+		EntitySet: "Temperatures",
+		Property:  property{Name: "int32", Type: odata.EdmInt32},
+	}
+
+	// Act
+	values, err := ds.distinctValues(context.TODO(), &is, request)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "int32", requestedSelect)
+	assert.Equal(t, []string{"2", "10"}, values)
+}
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// variablePattern matches template variable references like $var and ${var}
+var variablePattern = regexp.MustCompile(`\$(\w+)|\$\{(\w+)\}`)
+
+// interpolate resolves template variables in the entity set name, the search expression and the filter values. The
+// frontend sends the current values of the variables with the query. Queries without them, e.g. of alert rules, are
+// left as they are. A value consisting of a single multi-value variable is expanded into a list of values. Unknown
+// variables are kept as they are.
+func (qm *queryModel) interpolate() error {
+	if len(qm.Variables) == 0 {
+		return nil
+	}
+	if values, ok := qm.variableValues(qm.EntitySet.Name); ok && len(values) != 1 {
+		return fmt.Errorf("entity set variable %s must have exactly one value", qm.EntitySet.Name)
+	}
+	qm.EntitySet.Name = qm.replaceVariables(qm.EntitySet.Name)
+	qm.Search = qm.replaceVariables(qm.Search)
+	for i := range qm.FilterConditions {
+		qm.interpolateCondition(&qm.FilterConditions[i])
+	}
+	if qm.Filter != nil {
+		qm.interpolateNode(qm.Filter)
+	}
+	return nil
+}
+
+func (qm *queryModel) interpolateNode(node *filterNode) {
+	if node.Condition != nil {
+		qm.interpolateCondition(node.Condition)
+	}
+	for i := range node.Children {
+		qm.interpolateNode(&node.Children[i])
+	}
+}
+
+func (qm *queryModel) interpolateCondition(condition *filterCondition) {
+	if values, ok := qm.variableValues(condition.Value); ok && len(values) != 1 {
+		// Expanded into the values below
+		condition.Values = append([]string{condition.Value}, condition.Values...)
+		condition.Value = ""
+	} else {
+		condition.Value = qm.replaceVariables(condition.Value)
+	}
+	var values []string
+	for _, value := range condition.Values {
+		if variableValues, ok := qm.variableValues(value); ok {
+			values = append(values, variableValues...)
+		} else {
+			values = append(values, qm.replaceVariables(value))
+		}
+	}
+	condition.Values = values
+}
+
+// variableValues returns the values of the variable if the text consists of a single known variable reference
+func (qm *queryModel) variableValues(text string) ([]string, bool) {
+	match := variablePattern.FindStringSubmatch(text)
+	if match == nil || match[0] != text {
+		return nil, false
+	}
+	values, ok := qm.Variables[match[1]+match[2]]
+	return values, ok
+}
+
+// replaceVariables replaces known variable references in the text, values of multi-value variables are joined with
+// commas
+func (qm *queryModel) replaceVariables(text string) string {
+	return variablePattern.ReplaceAllStringFunc(text, func(reference string) string {
+		match := variablePattern.FindStringSubmatch(reference)
+		values, ok := qm.Variables[match[1]+match[2]]
+		if !ok {
+			return reference
+		}
+		return strings.Join(values, ",")
+	})
+}
@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/d-velop/grafana-odata-datasource/pkg/plugin/odata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolate(t *testing.T) {
+	tables := []struct {
+		name              string
+		queryModel        *queryModel
+		version           string
+		expectedEntitySet string
+		expectedFilter    string
+		expectedError     string
+	}{
+		{
+			name: "Single value",
+			queryModel: aQueryModel(withVariable("city", "Bonn"),
+				withFilterConditions(withFilterCondition(stringProp, "eq", "$city"))),
+			version:        odata.V4,
+			expectedFilter: "string eq 'Bonn'",
+		},
+		{
+			name: "Braces and embedded reference",
+			queryModel: aQueryModel(withVariable("city", "Bonn"),
+				withFilterConditions(withFilterCondition(stringProp, "startswith", "${city}-"))),
+			version:        odata.V4,
+			expectedFilter: "startswith(string,'Bonn-')",
+		},
+		{
+			name: "Multi-value eq on V4.01",
+			queryModel: aQueryModel(withVariable("city", "Bonn", "Köln"),
+				withFilterConditions(withFilterCondition(stringProp, "eq", "$city"))),
+			version:        "4.01",
+			expectedFilter: "string in ('Bonn','Köln')",
+		},
+		{
+			name: "Multi-value eq on V4.0",
+			queryModel: aQueryModel(withVariable("city", "Bonn", "Köln"),
+				withFilterConditions(withFilterCondition(stringProp, "eq", "$city"))),
+			version:        odata.V4,
+			expectedFilter: "(string eq 'Bonn' or string eq 'Köln')",
+		},
+		{
+			name: "Multi-value ne",
+			queryModel: aQueryModel(withVariable("city", "Bonn", "Köln"),
+				withFilterConditions(withFilterCondition(stringProp, "ne", "$city"))),
+			version:        odata.V4,
+			expectedFilter: "(string ne 'Bonn' and string ne 'Köln')",
+		},
+		{
+			name: "Multi-value contains",
+			queryModel: aQueryModel(withVariable("city", "Bo", "Kö"),
+				withFilterConditions(withFilterCondition(stringProp, "contains", "$city"))),
+			version:        odata.V4,
+			expectedFilter: "(contains(string,'Bo') or contains(string,'Kö'))",
+		},
+		{
+			name: "Multi-value in list values",
+			queryModel: aQueryModel(withVariable("ids", "1", "2"),
+				withFilter(aConditionNode(withFilterCondition(int32Prop, "in", ""), withValues("0", "$ids")))),
+			version:        "4.01",
+			expectedFilter: "int32 in (0,1,2)",
+		},
+		{
+			name: "Filter tree",
+			queryModel: aQueryModel(withVariable("ids", "1", "2"),
+				withFilter(negated(anOrGroup(aConditionNode(withFilterCondition(int32Prop, "eq", "$ids")))))),
+			version:        odata.V4,
+			expectedFilter: "not ((int32 eq 1 or int32 eq 2))",
+		},
+		{
+			name: "Unknown variable",
+			queryModel: aQueryModel(withVariable("city", "Bonn"),
+				withFilterConditions(withFilterCondition(stringProp, "eq", "$town"))),
+			version:        odata.V4,
+			expectedFilter: "string eq '$town'",
+		},
+		{
+			name:              "Entity set",
+			queryModel:        aQueryModel(withVariable("set", "Temperatures"), withEntitySetName("${set}")),
+			expectedEntitySet: "Temperatures",
+		},
+		{
+			name:          "Multi-value entity set",
+			queryModel:    aQueryModel(withVariable("set", "A", "B"), withEntitySetName("$set")),
+			expectedError: "entity set variable $set must have exactly one value",
+		},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			// Act
+			err := table.queryModel.interpolate()
+
+			// Assert
+			if table.expectedError != "" {
+				assert.ErrorContains(t, err, table.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			if table.expectedEntitySet != "" {
+				assert.Equal(t, table.expectedEntitySet, table.queryModel.EntitySet.Name)
+			}
+			filter, err := combineFilters(table.queryModel.FilterConditions, table.queryModel.Filter, table.version)
+			assert.NoError(t, err)
+			assert.Equal(t, table.expectedFilter, filter)
+		})
+	}
+}
@@ -1,21 +1,73 @@
-import { DataSourceInstanceSettings, ScopedVars } from '@grafana/data';
+import { DataSourceInstanceSettings, MetricFindValue, ScopedVars } from '@grafana/data';
 import { DataSourceWithBackend, getTemplateSrv } from '@grafana/runtime';
-import { ODataOptions, ODataQuery } from './types';
+import { FilterCondition, FilterNode, ODataOptions, ODataQuery, QueryType, VariableQuery } from './types';
+
+// Matches a value that consists of a single variable reference the backend resolves, e.g. '$city' or '${city}'
+const variableReference = /^\$(?:(\w+)|\{(\w+)\})$/;
 
 export class ODataSource extends DataSourceWithBackend<ODataQuery, ODataOptions> {
   constructor(instanceSettings: DataSourceInstanceSettings<ODataOptions>) {
     super(instanceSettings);
+    // Annotation queries are run by the backend like other queries, the query type selects the annotation frame
+    this.annotations = {
+      prepareAnnotation: (json) => ({
+        ...json,
+        target: { ...(json.target ?? { refId: 'Anno' }), queryType: QueryType.Annotations },
+      }),
+    };
   }
 
+  // Values that consist of a single variable reference are resolved by the backend, which expands multi-value
+  // variables into lists. The current values are sent with the query. Other references, e.g. with a format like
+  // '${city:csv}', built-in variables like '$__from' or references within a text, are replaced here.
   applyTemplateVariables(query: ODataQuery, scopedVars: ScopedVars) {
     const templateSrv = getTemplateSrv();
-
-    query.filterConditions?.forEach((filterCondition) => {
-      filterCondition.value = templateSrv.replace(filterCondition.value, scopedVars);
+    const names = new Set([...templateSrv.getVariables().map((variable) => variable.name), ...Object.keys(scopedVars)]);
+    const variables: Record<string, string[]> = {};
+    names.forEach((name) => {
+      const json = templateSrv.replace(`\${${name}}`, scopedVars, (value: unknown) =>
+        JSON.stringify(Array.isArray(value) ? value.map(String) : [String(value)])
+      );
+      try {
+        variables[name] = JSON.parse(json);
+      } catch {
+        // Not resolvable, e.g. a variable that depends on an unresolved variable
+      }
+    });
+    const replace = (text: string) => {
+      const match = text.match(variableReference);
+      return match && variables[match[1] ?? match[2]] ? text : templateSrv.replace(text, scopedVars);
+    };
+    const replaceCondition = (condition: FilterCondition): FilterCondition => ({
+      ...condition,
+      value: replace(condition.value ?? ''),
+      values: condition.values?.map(replace),
+    });
+    const replaceNode = (node: FilterNode): FilterNode => ({
+      ...node,
+      condition: node.condition && replaceCondition(node.condition),
+      children: node.children?.map(replaceNode),
     });
 
     return {
       ...query,
+      entitySet: query.entitySet && { ...query.entitySet, name: replace(query.entitySet.name) },
+      search: query.search && replace(query.search),
+      filterConditions: query.filterConditions?.map(replaceCondition),
+      filter: query.filter && replaceNode(query.filter),
+      variables,
     };
   }
+
+  // Lists the distinct values of a property as template variable values
+  async metricFindQuery(query: VariableQuery): Promise<MetricFindValue[]> {
+    if (!query.entitySet || !query.property) {
+      return [];
+    }
+    const values: string[] = await this.postResource('values', {
+      entitySet: query.entitySet.name,
+      property: query.property,
+    });
+    return values.map((value) => ({ text: value }));
+  }
 }
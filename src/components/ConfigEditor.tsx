@@ -2,12 +2,20 @@ import {
   DataSourcePluginOptionsEditorProps,
   SelectableValue
 } from '@grafana/data';
-import {DataSourceHttpSettings, FieldSet, InlineField, InlineFieldRow, Select} from '@grafana/ui';
-import React, {ComponentType, useCallback} from 'react';
+import {DataSourceHttpSettings, FieldSet, InlineField, InlineFieldRow, InlineSwitch, Input, Select} from '@grafana/ui';
+import React, {ChangeEvent, ComponentType, FormEvent, useCallback} from 'react';
 import {ODataOptions, URLSpaceEncoding} from '../types';
 
 type Props = DataSourcePluginOptionsEditorProps<ODataOptions>;
 
+type NumberOption =
+  | 'maxPages'
+  | 'maxRows'
+  | 'maxResponseSize'
+  | 'maxConcurrentQueries'
+  | 'maxConcurrentRequests'
+  | 'metadataCacheTtl';
+
 export const ConfigEditor: ComponentType<Props> = ({ options, onOptionsChange }) => {
   const onURLSpaceEncodingChange = useCallback((option: SelectableValue<URLSpaceEncoding>) => {
       const urlSpaceEncoding = option.value;
@@ -20,6 +28,28 @@ export const ConfigEditor: ComponentType<Props> = ({ options, onOptionsChange })
       });
   }, [onOptionsChange, options]);
 
+  const onNumberOptionChange = useCallback((key: NumberOption) =>
+    (event: ChangeEvent<HTMLInputElement>) => {
+      const value = parseInt(event.target.value, 10);
+      onOptionsChange({
+        ...options,
+        jsonData: {
+          ...options.jsonData,
+          [key]: isNaN(value) ? undefined : value,
+        },
+      });
+  }, [onOptionsChange, options]);
+
+  const onBatchRequestsChange = useCallback((event: FormEvent<HTMLInputElement>) => {
+      onOptionsChange({
+        ...options,
+        jsonData: {
+          ...options.jsonData,
+          batchRequests: event.currentTarget.checked,
+        },
+      });
+  }, [onOptionsChange, options]);
+
   const urlSpaceEncodings = Object.entries(URLSpaceEncoding)
     .map(([label, value]) => ({ label: `${label} (${value})`, value: value }));
 
@@ -55,6 +85,104 @@ export const ConfigEditor: ComponentType<Props> = ({ options, onOptionsChange })
               />
             </InlineField>
           </InlineFieldRow>
+          <InlineFieldRow>
+            <InlineField
+              label='Max pages'
+              labelWidth={26}
+              tooltip='Maximum number of pages followed via @odata.nextLink per query. Defaults to 100.'>
+              <Input
+                type='number'
+                className='width-10'
+                placeholder='100'
+                value={options.jsonData.maxPages ?? ''}
+                onChange={onNumberOptionChange('maxPages')}
+              />
+            </InlineField>
+          </InlineFieldRow>
+          <InlineFieldRow>
+            <InlineField
+              label='Max rows'
+              labelWidth={26}
+              tooltip='Maximum number of rows returned per query. Leave empty for no limit.'>
+              <Input
+                type='number'
+                className='width-10'
+                placeholder='unlimited'
+                value={options.jsonData.maxRows ?? ''}
+                onChange={onNumberOptionChange('maxRows')}
+              />
+            </InlineField>
+          </InlineFieldRow>
+          <InlineFieldRow>
+            <InlineField
+              label='Max response size (MB)'
+              labelWidth={26}
+              tooltip='Maximum size of the responses read per query, larger results fail. Defaults to 100.'>
+              <Input
+                type='number'
+                className='width-10'
+                placeholder='100'
+                value={options.jsonData.maxResponseSize ?? ''}
+                onChange={onNumberOptionChange('maxResponseSize')}
+              />
+            </InlineField>
+          </InlineFieldRow>
+          <InlineFieldRow>
+            <InlineField
+              label='Max concurrent queries'
+              labelWidth={26}
+              tooltip='Number of queries of a panel or dashboard request executed at the same time. Defaults to 5.'>
+              <Input
+                type='number'
+                className='width-10'
+                placeholder='5'
+                value={options.jsonData.maxConcurrentQueries ?? ''}
+                onChange={onNumberOptionChange('maxConcurrentQueries')}
+              />
+            </InlineField>
+          </InlineFieldRow>
+          <InlineFieldRow>
+            <InlineField
+              label='Max concurrent requests'
+              labelWidth={26}
+              tooltip='Number of requests sent to the service at the same time by all queries. Defaults to 10.'>
+              <Input
+                type='number'
+                className='width-10'
+                placeholder='10'
+                value={options.jsonData.maxConcurrentRequests ?? ''}
+                onChange={onNumberOptionChange('maxConcurrentRequests')}
+              />
+            </InlineField>
+          </InlineFieldRow>
+          <InlineFieldRow>
+            <InlineField
+              label='Batch requests'
+              labelWidth={26}
+              tooltip={
+                'Send the queries of a panel or dashboard request in a single $batch request. Follow-up requests, ' +
+                'e.g. for further pages, are sent individually.'
+              }>
+              <InlineSwitch value={options.jsonData.batchRequests ?? false} onChange={onBatchRequestsChange} />
+            </InlineField>
+          </InlineFieldRow>
+          <InlineFieldRow>
+            <InlineField
+              label='Metadata cache TTL'
+              labelWidth={26}
+              tooltip={
+                'Seconds the service metadata is reused before it is revalidated. Defaults to 300, a negative value ' +
+                'revalidates the metadata every time the query editor loads.'
+              }>
+              <Input
+                type='number'
+                className='width-10'
+                placeholder='300'
+                value={options.jsonData.metadataCacheTtl ?? ''}
+                onChange={onNumberOptionChange('metadataCacheTtl')}
+              />
+            </InlineField>
+          </InlineFieldRow>
         </FieldSet>
       </div>
       </>
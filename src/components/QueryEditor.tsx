@@ -1,11 +1,71 @@
 import React, { PureComponent } from 'react';
-import { Alert, Button, InlineFormLabel, LegacyForms, Input } from '@grafana/ui';
+import { Alert, Button, InlineFormLabel, InlineSwitch, LegacyForms, Input } from '@grafana/ui';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
 import { ODataSource } from '../DataSource';
-import { EntitySet, Metadata, ODataOptions, ODataQuery, Property, FilterOperators } from '../types';
+import {
+  Aggregate,
+  Aggregation,
+  AggregationMethods,
+  Annotation,
+  EntitySet,
+  FilterCondition,
+  FilterNode,
+  Metadata,
+  ODataOptions,
+  ODataQuery,
+  OrderBy,
+  Property,
+  FilterOperators,
+  NullFilterOperators,
+  QueryType,
+  TimePropertyTypes,
+  entityTypeProperties,
+} from '../types';
 
 const { Select } = LegacyForms;
 
+const queryTypes: Array<SelectableValue<QueryType>> = [
+  { label: 'Entities', value: QueryType.Entities },
+  { label: 'Aggregation', value: QueryType.Aggregation, description: 'Grouped and aggregated entities ($apply)' },
+  { label: 'Count', value: QueryType.Count, description: 'Number of matching entities ($count)' },
+];
+
+const aggregationMethods: Array<SelectableValue<string>> = AggregationMethods.map((method) => ({
+  label: method,
+  value: method,
+}));
+
+const directions: Array<SelectableValue<'asc' | 'desc'>> = [
+  { label: 'Ascending', value: 'asc' },
+  { label: 'Descending', value: 'desc' },
+];
+
+const groupOperators: Array<SelectableValue<'and' | 'or'>> = [
+  { label: 'All of', value: 'and', description: 'All conditions of the group must hold (and)' },
+  { label: 'Any of', value: 'or', description: 'One of the conditions of the group must hold (or)' },
+];
+
+const emptyCondition = (): FilterCondition => ({ property: { name: '', type: '' }, operator: '', value: '' });
+
+// Replaces the node at the path of child indices within the filter tree, the node is removed if there is no replacement
+function replaceFilterNode(
+  node: FilterNode,
+  path: number[],
+  replace: (node: FilterNode) => FilterNode | undefined
+): FilterNode | undefined {
+  if (path.length === 0) {
+    return replace(node);
+  }
+  const children = [...(node.children ?? [])];
+  const child = replaceFilterNode(children[path[0]], path.slice(1), replace);
+  if (child) {
+    children[path[0]] = child;
+  } else {
+    children.splice(path[0], 1);
+  }
+  return { ...node, children };
+}
+
 type Props = QueryEditorProps<ODataSource, ODataQuery, ODataOptions>;
 
 interface State {
@@ -41,7 +101,26 @@ export class QueryEditor extends PureComponent<Props, State> {
 
   componentDidMount() {
     this._isMounted = true;
-    this.dataSource.getResource('metadata').then((metadata: Metadata) => {
+    this.loadMetadata(this.dataSource.getResource('metadata'));
+    const filterOperators: Array<SelectableValue<string>> = FilterOperators.map((operator) => ({
+      label: operator,
+      value: operator,
+    }));
+    this.setState({
+      filterOperators: filterOperators,
+    });
+  }
+
+  componentWillUnmount() {
+    this._isMounted = false;
+  }
+
+  refreshMetadata = () => {
+    this.loadMetadata(this.dataSource.postResource('metadata/refresh'));
+  };
+
+  loadMetadata(request: Promise<Metadata>) {
+    request.then((metadata: Metadata) => {
       if (!this._isMounted) {
         return;
       }
@@ -61,17 +140,6 @@ export class QueryEditor extends PureComponent<Props, State> {
       }
       this.setState({ metadataError: err?.message ?? 'Failed to load metadata' });
     });
-    const filterOperators: Array<SelectableValue<string>> = FilterOperators.map((operator) => ({
-      label: operator,
-      value: operator,
-    }));
-    this.setState({
-      filterOperators: filterOperators,
-    });
-  }
-
-  componentWillUnmount() {
-    this._isMounted = false;
   }
 
   mapProperties(metadata: Metadata | undefined, entityType: string | undefined, propertyKind: PropertyKind) {
@@ -79,10 +147,10 @@ export class QueryEditor extends PureComponent<Props, State> {
       return [];
     }
     return (propertyKind === PropertyKind.Time ? [{ label: '(None)', value: undefined as Property | undefined }] : [])
-      .concat(metadata.entityTypes[entityType].properties
+      .concat(entityTypeProperties(metadata, entityType)
         .filter(property =>
           propertyKind === PropertyKind.All ||
-          (propertyKind === PropertyKind.Time && property.type === 'Edm.DateTimeOffset')
+          (propertyKind === PropertyKind.Time && TimePropertyTypes.includes(property.type))
         )
         .map(property => ({
           label: property.name,
@@ -126,7 +194,7 @@ export class QueryEditor extends PureComponent<Props, State> {
     }
     const properties = [...this.props.query.properties!];
     properties[index] = option.value ?? { name: '', type: '' };
-    this.update({ ...this.props.query, properties });
+    this.update({ ...this.props.query, properties, explode: this.keepExplode(properties) });
   };
 
   addProperty = () => {
@@ -137,14 +205,17 @@ export class QueryEditor extends PureComponent<Props, State> {
   removeProperty = (index: number) => {
     const properties = [...this.props.query.properties!];
     properties.splice(index, 1);
-    this.update({ ...this.props.query, properties });
+    this.update({ ...this.props.query, properties, explode: this.keepExplode(properties) });
   };
 
+  // The exploded property must remain selected
+  keepExplode(properties: Property[]) {
+    const { explode } = this.props.query;
+    return properties.some((p) => p.name === explode) ? explode : undefined;
+  }
+
   addFilterCondition = () => {
-    const filterConditions = [
-      ...(this.props.query.filterConditions ?? []),
-      { property: { name: '', type: '' }, operator: '', value: '' },
-    ];
+    const filterConditions = [...(this.props.query.filterConditions ?? []), emptyCondition()];
     this.update({ ...this.props.query, filterConditions });
   };
 
@@ -154,45 +225,377 @@ export class QueryEditor extends PureComponent<Props, State> {
     this.update({ ...this.props.query, filterConditions });
   };
 
-  onFilterPropertyChange = (option: SelectableValue<Property>, index: number) => {
-    const filterCondition = this.props.query.filterConditions![index];
-    if (option.value?.name === filterCondition.property.name) {
-      return;
-    }
-    const property = option.value
-      ? { name: option.value.name, type: this.state.allProperties.find((item) => item.value?.name === option.value?.name)?.value?.type ?? '' }
-      : { name: '', type: '' };
+  onFilterConditionChange = (changed: Partial<FilterCondition>, index: number, run = true) => {
     const filterConditions = [...this.props.query.filterConditions!];
-    filterConditions[index] = { ...filterCondition, property };
-    this.update({ ...this.props.query, filterConditions });
+    filterConditions[index] = { ...filterConditions[index], ...changed };
+    const updatedQuery = { ...this.props.query, filterConditions };
+    if (run) {
+      this.update(updatedQuery);
+    } else {
+      this.props.onChange(updatedQuery);
+    }
   };
 
-  onFilterOperatorChange = (option: SelectableValue<string>, index: number) => {
-    const filterCondition = this.props.query.filterConditions![index];
-    const operator = option.value ?? '';
-    if (operator === filterCondition.operator) {
-      return;
+  // The filter tree combines conditions with 'or' and 'not', it is and-ed with the filter conditions above
+  onFilterNodeChange = (path: number[], replace: (node: FilterNode) => FilterNode | undefined, run = true) => {
+    const filter = this.props.query.filter && replaceFilterNode(this.props.query.filter, path, replace);
+    const updatedQuery = { ...this.props.query, filter };
+    if (run) {
+      this.update(updatedQuery);
+    } else {
+      this.props.onChange(updatedQuery);
     }
-    const filterConditions = [...this.props.query.filterConditions!];
-    filterConditions[index] = { ...filterCondition, operator };
-    this.update({ ...this.props.query, filterConditions });
   };
 
-  onFilterValueChange = (value: string, index: number) => {
-    const filterCondition = this.props.query.filterConditions![index];
-    if (value === filterCondition.value) {
+  addFilterGroup = () => {
+    this.update({ ...this.props.query, filter: { operator: 'or', children: [{ condition: emptyCondition() }] } });
+  };
+
+  addOrderBy = () => {
+    const orderBy: OrderBy[] = [...(this.props.query.orderBy ?? []), { property: { name: '', type: '' } }];
+    this.update({ ...this.props.query, orderBy });
+  };
+
+  removeOrderBy = (index: number) => {
+    const orderBy = [...this.props.query.orderBy!];
+    orderBy.splice(index, 1);
+    this.update({ ...this.props.query, orderBy });
+  };
+
+  onOrderByChange = (changed: Partial<OrderBy>, index: number) => {
+    const orderBy = [...this.props.query.orderBy!];
+    orderBy[index] = { ...orderBy[index], ...changed };
+    this.update({ ...this.props.query, orderBy });
+  };
+
+  onTopChange = (value: string) => {
+    const top = parseInt(value, 10);
+    this.props.onChange({ ...this.props.query, top: top > 0 ? top : undefined });
+  };
+
+  onQueryTypeChange = (option: SelectableValue<QueryType>) => {
+    const queryType = option.value ?? QueryType.Entities;
+    if ((this.props.query.queryType ?? QueryType.Entities) === queryType) {
       return;
     }
-    const filterConditions = [...this.props.query.filterConditions!];
-    filterConditions[index] = { ...filterCondition, value };
-    this.props.onChange({ ...this.props.query, filterConditions });
+    this.update({ ...this.props.query, queryType });
+  };
+
+  onAggregationChange = (aggregation: Aggregation, run = true) => {
+    const updatedQuery = { ...this.props.query, aggregation: { ...this.props.query.aggregation, ...aggregation } };
+    if (run) {
+      this.update(updatedQuery);
+    } else {
+      this.props.onChange(updatedQuery);
+    }
   };
 
+  addAggregate = () => {
+    const aggregates: Aggregate[] = [...(this.props.query.aggregation?.aggregates ?? []), { method: 'sum' }];
+    this.onAggregationChange({ aggregates });
+  };
+
+  removeAggregate = (index: number) => {
+    const aggregates = [...this.props.query.aggregation!.aggregates!];
+    aggregates.splice(index, 1);
+    this.onAggregationChange({ aggregates });
+  };
+
+  onAggregateChange = (changed: Partial<Aggregate>, index: number, run = true) => {
+    const aggregates = [...this.props.query.aggregation!.aggregates!];
+    aggregates[index] = { ...aggregates[index], ...changed };
+    this.onAggregationChange({ aggregates }, run);
+  };
+
+  onAnnotationChange = (annotation: Annotation) => {
+    this.update({ ...this.props.query, annotation: { ...this.props.query.annotation, ...annotation } });
+  };
+
+  renderAggregation() {
+    const { allProperties } = this.state;
+    const aggregation = this.props.query.aggregation ?? {};
+    const listAggregates = aggregation.aggregates?.map((aggregate, index) => (
+      <div key={index} className="gf-form">
+        <InlineFormLabel width={8} tooltip="Aggregated value, count needs no property">
+          Aggregate
+        </InlineFormLabel>
+        <Select
+          value={aggregationMethods.find((o) => o.value === aggregate.method)}
+          onChange={(option) => this.onAggregateChange({ method: option?.value ?? 'sum' }, index)}
+          options={aggregationMethods}
+          isSearchable={false}
+        />
+        {aggregate.method !== 'count' && (
+          <Select
+            value={allProperties.find((o) => o.value?.name === aggregate.property?.name)}
+            isClearable={true}
+            placeholder="(Property)"
+            onChange={(option) => this.onAggregateChange({ property: option?.value }, index)}
+            options={allProperties}
+            isSearchable={false}
+          />
+        )}
+        <Input
+          value={aggregate.alias ?? ''}
+          type="text"
+          placeholder="(alias)"
+          onChange={(item) => this.onAggregateChange({ alias: item.currentTarget.value || undefined }, index, false)}
+          onBlur={this.props.onRunQuery}
+        />
+        <Button variant={'secondary'} onClick={() => this.removeAggregate(index)}>
+          -
+        </Button>
+      </div>
+    ));
+    return (
+      <div>
+        <div className="gf-form">
+          <InlineFormLabel width={8} tooltip="Properties to group by, each group gets a row of its own">
+            Group by
+          </InlineFormLabel>
+          <Select
+            isMulti={true}
+            value={allProperties.filter((o) => aggregation.groupBy?.some((p) => p.name === o.value?.name))}
+            placeholder="(Properties)"
+            onChange={(options: Array<SelectableValue<Property>>) =>
+              this.onAggregationChange({
+                groupBy: (options ?? []).map((o) => o.value).filter((p): p is Property => !!p),
+              })
+            }
+            options={allProperties}
+            isSearchable={false}
+          />
+        </div>
+        {listAggregates}
+        <div className="gf-form">
+          <Button variant={'secondary'} onClick={this.addAggregate}>
+            + Aggregate
+          </Button>
+        </div>
+        <div className="gf-form">
+          <InlineFormLabel
+            width={8}
+            tooltip="Aggregates per interval of the time property, 'auto' for the query interval or a duration like 15m"
+          >
+            Time bucket
+          </InlineFormLabel>
+          <Input
+            value={aggregation.timeBucket ?? ''}
+            type="text"
+            placeholder="(whole time range)"
+            onChange={(item) => this.onAggregationChange({ timeBucket: item.currentTarget.value }, false)}
+            onBlur={this.props.onRunQuery}
+          />
+        </div>
+      </div>
+    );
+  }
+
+  renderAnnotation() {
+    const { timeProperties, allProperties } = this.state;
+    const annotation = this.props.query.annotation ?? {};
+    const find = (options: Array<SelectableValue<Property>>, property?: Property) =>
+      options.find((o) => o.value && o.value.name === property?.name);
+    return (
+      <div className="gf-form-inline">
+        <div className="gf-form">
+          <InlineFormLabel width={8} tooltip="End time of regions, leave empty for single events">
+            End time
+          </InlineFormLabel>
+          <Select
+            value={find(timeProperties, annotation.timeEndProperty)}
+            isClearable={true}
+            placeholder="(Property)"
+            onChange={(option) => this.onAnnotationChange({ timeEndProperty: option?.value })}
+            options={timeProperties}
+            isSearchable={false}
+          />
+          <InlineFormLabel width={8}>Title</InlineFormLabel>
+          <Select
+            value={find(allProperties, annotation.titleProperty)}
+            isClearable={true}
+            placeholder="(Property)"
+            onChange={(option) => this.onAnnotationChange({ titleProperty: option?.value })}
+            options={allProperties}
+            isSearchable={false}
+          />
+          <InlineFormLabel width={8}>Text</InlineFormLabel>
+          <Select
+            value={find(allProperties, annotation.textProperty)}
+            isClearable={true}
+            placeholder="(Property)"
+            onChange={(option) => this.onAnnotationChange({ textProperty: option?.value })}
+            options={allProperties}
+            isSearchable={false}
+          />
+          <InlineFormLabel width={8} tooltip="Properties whose values become the tags of the annotations">
+            Tags
+          </InlineFormLabel>
+          <Select
+            isMulti={true}
+            value={allProperties.filter((o) => annotation.tagProperties?.some((p) => p.name === o.value?.name))}
+            placeholder="(Properties)"
+            onChange={(options: Array<SelectableValue<Property>>) =>
+              this.onAnnotationChange({
+                tagProperties: (options ?? []).map((o) => o.value).filter((p): p is Property => !!p),
+              })
+            }
+            options={allProperties}
+            isSearchable={false}
+          />
+        </div>
+      </div>
+    );
+  }
+
+  // Renders a filter condition, a changed value is run when the input loses the focus
+  renderCondition(
+    key: React.Key,
+    label: string,
+    condition: FilterCondition,
+    onChange: (changed: Partial<FilterCondition>, run?: boolean) => void,
+    onRemove: () => void
+  ) {
+    const { allProperties, filterOperators, metadata } = this.state;
+    // Filter values of enum properties are chosen from the members, the backend qualifies them like NS.Color'Red'
+    const enumMembers: Array<SelectableValue<string>> | undefined = metadata?.enumTypes?.[
+      condition.property.type
+    ]?.members.map((m) => ({ label: m.name, value: m.name }));
+    // Null operators take no value
+    const takesValue = !NullFilterOperators.includes(condition.operator);
+    let valueInput: React.ReactNode = null;
+    if (takesValue && enumMembers) {
+      valueInput = (
+        <Select
+          value={condition.value ? { label: condition.value, value: condition.value } : undefined}
+          allowCustomValue={true}
+          placeholder="(value)"
+          onChange={(item) => onChange({ value: item?.value ?? '' })}
+          options={enumMembers}
+        />
+      );
+    } else if (takesValue) {
+      valueInput = (
+        <Input
+          required={true}
+          value={condition.value}
+          type="text"
+          placeholder="(value)"
+          onChange={(item) => onChange({ value: item.currentTarget.value }, false)}
+          onBlur={this.props.onRunQuery}
+        />
+      );
+    }
+    return (
+      <div key={key} className="gf-form-inline">
+        <div className={'gf-form'}>
+          <InlineFormLabel width={8} tooltip={'Add filter condition'}>
+            {label}
+          </InlineFormLabel>
+          <Select
+            value={allProperties.find((item) => item.value?.name === condition.property.name)}
+            isClearable={true}
+            placeholder="(Property)"
+            onChange={(item) => onChange({ property: item?.value ?? { name: '', type: '' } })}
+            options={allProperties}
+            isSearchable={false}
+          />
+          <Select
+            value={condition.operator ? { label: condition.operator, value: condition.operator } : undefined}
+            isClearable={true}
+            placeholder="(Operator)"
+            onChange={(item) => onChange({ operator: item?.value ?? '' })}
+            options={filterOperators}
+            isSearchable={false}
+          />
+          {valueInput}
+          {takesValue && condition.property.type === 'Edm.String' && (
+            <>
+              <InlineFormLabel width={6} tooltip="Compare the lowercased values (tolower)">
+                Ignore case
+              </InlineFormLabel>
+              <InlineSwitch
+                value={condition.caseInsensitive ?? false}
+                onChange={(event) => onChange({ caseInsensitive: event.currentTarget.checked || undefined })}
+              />
+            </>
+          )}
+          <Button variant={'secondary'} onClick={onRemove}>
+            -
+          </Button>
+        </div>
+      </div>
+    );
+  }
+
+  // Renders a node of the filter tree, groups list their children indented below
+  renderFilterNode(node: FilterNode, path: number[], label: string): React.ReactNode {
+    const key = path.join('-');
+    if (node.condition) {
+      return this.renderCondition(
+        key,
+        label,
+        node.condition,
+        (changed, run) =>
+          this.onFilterNodeChange(path, (n) => ({ ...n, condition: { ...n.condition!, ...changed } }), run),
+        () => this.onFilterNodeChange(path, () => undefined)
+      );
+    }
+    const operator = node.operator ?? 'and';
+    const addChild = (child: FilterNode) =>
+      this.onFilterNodeChange(path, (n) => ({ ...n, children: [...(n.children ?? []), child] }));
+    return (
+      <div key={key}>
+        <div className="gf-form">
+          <InlineFormLabel width={8} tooltip="Conditions combined with and or or, and-ed with the conditions above">
+            {label}
+          </InlineFormLabel>
+          <Select
+            value={groupOperators.find((o) => o.value === operator)}
+            onChange={(option) => this.onFilterNodeChange(path, (n) => ({ ...n, operator: option?.value ?? 'and' }))}
+            options={groupOperators}
+            isSearchable={false}
+          />
+          <InlineFormLabel width={4} tooltip="Negates the group (not)">
+            Not
+          </InlineFormLabel>
+          <InlineSwitch
+            value={node.not ?? false}
+            onChange={(event) => {
+              const not = event.currentTarget.checked;
+              this.onFilterNodeChange(path, (n) => ({ ...n, not }));
+            }}
+          />
+          <Button variant={'secondary'} onClick={() => addChild({ condition: emptyCondition() })}>
+            + Condition
+          </Button>
+          <Button
+            variant={'secondary'}
+            onClick={() => addChild({ operator: 'and', children: [{ condition: emptyCondition() }] })}
+          >
+            + Group
+          </Button>
+          <Button variant={'secondary'} onClick={() => this.onFilterNodeChange(path, () => undefined)}>
+            -
+          </Button>
+        </div>
+        <div style={{ paddingLeft: 16 }}>
+          {node.children?.map((child, index) =>
+            this.renderFilterNode(child, [...path, index], index === 0 ? 'Condition' : operator.toUpperCase())
+          )}
+        </div>
+      </div>
+    );
+  }
+
   render() {
-    const { entitySets, timeProperties, allProperties, filterOperators, metadataError } = this.state;
+    const { entitySets, timeProperties, allProperties, metadataError } = this.state;
     if (metadataError) {
       return <Alert title="Failed to load metadata" severity="error">{metadataError}</Alert>;
     }
+    const collectionProperties: Array<SelectableValue<string>> = (this.props.query.properties ?? [])
+      .filter((p) => p.type.startsWith('Collection('))
+      .map((p) => ({ label: p.name, value: p.name }));
     const listProperties = this.props.query.properties?.map((selectedProperty, index) => (
         <div key={index} className={'gf-form'}>
           <InlineFormLabel width={8} tooltip={'Add select'}>
@@ -211,50 +614,54 @@ export class QueryEditor extends PureComponent<Props, State> {
           </Button>
         </div>
     ));
-    const listFilters = this.props.query.filterConditions?.map((filterCondition, index) => (
-        <div key={index} className="gf-form-inline">
-          <div className={'gf-form'}>
-            <InlineFormLabel width={8} tooltip={'Add filter condition'}>
-              {index === 0 ? 'Filter' : 'AND'}
-            </InlineFormLabel>
-            <Select
-              value={allProperties.find(
-                (item) => item.value?.name === this.props.query.filterConditions?.[index].property.name
-              )}
-              isClearable={true}
-              placeholder="(Property)"
-              onChange={(item) => this.onFilterPropertyChange(item, index)}
-              options={allProperties}
-              isSearchable={false}
-            />
-            <Select
-              value={
-                filterCondition.operator
-                  ? { label: filterCondition.operator, value: filterCondition.operator }
-                  : undefined
-              }
-              isClearable={true}
-              placeholder="(Operator)"
-              onChange={(item) => this.onFilterOperatorChange(item, index)}
-              options={filterOperators}
-              isSearchable={false}
-            />
-            <Input
-              required={true}
-              value={filterCondition.value}
-              type="text"
-              placeholder="(value)"
-              onChange={(item) => this.onFilterValueChange(item.currentTarget.value, index)}
-              onBlur={this.props.onRunQuery}
-            />
-            <Button variant={'secondary'} onClick={() => this.removeFilterCondition(index)}>
-              -
-            </Button>
-          </div>
+    const listFilters = this.props.query.filterConditions?.map((filterCondition, index) =>
+      this.renderCondition(
+        index,
+        index === 0 ? 'Filter' : 'AND',
+        filterCondition,
+        (changed, run) => this.onFilterConditionChange(changed, index, run),
+        () => this.removeFilterCondition(index)
+      )
+    );
+    const listOrderBy = this.props.query.orderBy?.map((orderBy, index) => (
+        <div key={index} className={'gf-form'}>
+          <InlineFormLabel width={8} tooltip={'Sort the entities ($orderby), the first property first'}>
+            {index === 0 ? 'Order by' : 'Then by'}
+          </InlineFormLabel>
+          <Select
+            value={allProperties.find((item) => item.value?.name === orderBy.property.name)}
+            isClearable={true}
+            placeholder="(Property)"
+            onChange={(item) => this.onOrderByChange({ property: item?.value ?? { name: '', type: '' } }, index)}
+            options={allProperties}
+            isSearchable={false}
+          />
+          <Select
+            value={directions.find((item) => item.value === (orderBy.direction ?? 'asc'))}
+            onChange={(item) => this.onOrderByChange({ direction: item?.value }, index)}
+            options={directions}
+            isSearchable={false}
+          />
+          <Button variant={'secondary'} onClick={() => this.removeOrderBy(index)}>
+            -
+          </Button>
         </div>
     ));
+    const queryType = this.props.query.queryType ?? QueryType.Entities;
+    const selectsProperties = queryType === QueryType.Entities || queryType === QueryType.Annotations;
     return (
       <div>
+        {queryType !== QueryType.Annotations && (
+          <div className="gf-form">
+            <InlineFormLabel width={8}>Query type</InlineFormLabel>
+            <Select
+              value={queryTypes.find((o) => o.value === queryType)}
+              onChange={this.onQueryTypeChange}
+              options={queryTypes}
+              isSearchable={false}
+            />
+          </div>
+        )}
         <div className="gf-form-inline">
           <div className="gf-form">
             <InlineFormLabel width={8} tooltip="Select an entity set for a list of available metrics.">
@@ -268,6 +675,12 @@ export class QueryEditor extends PureComponent<Props, State> {
               options={entitySets}
               isSearchable={false}
             />
+            <Button
+              variant={'secondary'}
+              icon={'sync'}
+              tooltip={'Reload the metadata of the service'}
+              onClick={this.refreshMetadata}
+            />
             <InlineFormLabel width={8} tooltip="Time property">
               Time property
             </InlineFormLabel>
@@ -281,20 +694,108 @@ export class QueryEditor extends PureComponent<Props, State> {
             />
           </div>
         </div>
-        {listProperties}
-        <div className="gf-form-inline">
-          <div className={'gf-form'}>
-            <Button variant={'secondary'} onClick={this.addProperty}>
-              + Select
-            </Button>
+        {selectsProperties && listProperties}
+        {selectsProperties && (
+          <div className="gf-form-inline">
+            <div className={'gf-form'}>
+              <Button variant={'secondary'} onClick={this.addProperty}>
+                + Select
+              </Button>
+            </div>
           </div>
-        </div>
+        )}
+        {queryType === QueryType.Aggregation && this.renderAggregation()}
+        {queryType === QueryType.Count && (
+          <div className="gf-form">
+            <InlineFormLabel
+              width={8}
+              tooltip="Counts per interval of the time property, 'auto' for the query interval or a duration like 15m"
+            >
+              Time bucket
+            </InlineFormLabel>
+            <Input
+              value={this.props.query.count?.timeBucket ?? ''}
+              type="text"
+              placeholder="(whole time range)"
+              onChange={(item) =>
+                this.props.onChange({ ...this.props.query, count: { timeBucket: item.currentTarget.value } })
+              }
+              onBlur={this.props.onRunQuery}
+            />
+          </div>
+        )}
         {listFilters}
+        {this.props.query.filter && this.renderFilterNode(this.props.query.filter, [], 'Filter group')}
         <div className={'gf-form'}>
           <Button variant={'secondary'} onClick={this.addFilterCondition}>
             + Filter condition
           </Button>
+          {!this.props.query.filter && (
+            <Button variant={'secondary'} onClick={this.addFilterGroup}>
+              + Filter group
+            </Button>
+          )}
+        </div>
+        {queryType !== QueryType.Count && listOrderBy}
+        {queryType !== QueryType.Count && (
+          <div className={'gf-form'}>
+            <Button variant={'secondary'} onClick={this.addOrderBy}>
+              + Order by
+            </Button>
+          </div>
+        )}
+        {queryType !== QueryType.Count && (
+          <div className="gf-form">
+            <InlineFormLabel width={8} tooltip="Maximum number of entities or aggregated rows ($top)">
+              Top
+            </InlineFormLabel>
+            <Input
+              value={this.props.query.top ?? ''}
+              type="number"
+              min={1}
+              placeholder="(no limit)"
+              onChange={(item) => this.onTopChange(item.currentTarget.value)}
+              onBlur={this.props.onRunQuery}
+            />
+          </div>
+        )}
+        <div className="gf-form">
+          <InlineFormLabel width={8} tooltip="Free-text search ($search), e.g. blue OR &quot;dark green&quot;">
+            Search
+          </InlineFormLabel>
+          <Input
+            value={this.props.query.search ?? ''}
+            type="text"
+            placeholder="(search)"
+            onChange={(item) => this.props.onChange({ ...this.props.query, search: item.currentTarget.value })}
+            onBlur={this.props.onRunQuery}
+          />
+        </div>
+        {selectsProperties && collectionProperties.length > 0 && (
+          <div className="gf-form">
+            <InlineFormLabel width={8} tooltip="Collection property whose elements each get a row of their own">
+              Explode
+            </InlineFormLabel>
+            <Select
+              value={collectionProperties.find((o) => o.value === this.props.query.explode)}
+              isClearable={true}
+              placeholder="(Property)"
+              onChange={(option) => this.update({ ...this.props.query, explode: option?.value })}
+              options={collectionProperties}
+              isSearchable={false}
+            />
+          </div>
+        )}
+        <div className="gf-form">
+          <InlineFormLabel width={8} tooltip="Return the numeric values of enum properties instead of the member names">
+            Numeric enums
+          </InlineFormLabel>
+          <InlineSwitch
+            value={this.props.query.numericEnums ?? false}
+            onChange={(event) => this.update({ ...this.props.query, numericEnums: event.currentTarget.checked })}
+          />
         </div>
+        {this.props.query.queryType === QueryType.Annotations && this.renderAnnotation()}
       </div>
     );
   }
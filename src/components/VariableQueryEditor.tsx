@@ -0,0 +1,72 @@
+import React, { useEffect, useState } from 'react';
+import { Alert, InlineFormLabel, LegacyForms } from '@grafana/ui';
+import { SelectableValue } from '@grafana/data';
+import { ODataSource } from '../DataSource';
+import { EntitySet, Metadata, Property, VariableQuery, flattenProperties } from '../types';
+
+const { Select } = LegacyForms;
+
+interface Props {
+  query: VariableQuery;
+  datasource: ODataSource;
+  onChange: (query: VariableQuery, definition: string) => void;
+}
+
+export const VariableQueryEditor = ({ query, datasource, onChange }: Props) => {
+  const [metadata, setMetadata] = useState<Metadata>();
+  const [metadataError, setMetadataError] = useState<string>();
+
+  useEffect(() => {
+    datasource
+      .getResource('metadata')
+      .then(setMetadata)
+      .catch((err: Error) => setMetadataError(err?.message ?? 'Failed to load metadata'));
+  }, [datasource]);
+
+  const entitySets: Array<SelectableValue<EntitySet>> = Object.values(metadata?.entitySets ?? {}).map(
+    (entitySet) => ({ label: entitySet.name, value: entitySet })
+  );
+  const entityType = query.entitySet ? metadata?.entityTypes[query.entitySet.entityType] : undefined;
+  const properties: Array<SelectableValue<Property>> = (
+    metadata && entityType ? flattenProperties(metadata, entityType.properties) : []
+  ).map((property) => ({
+    label: property.name,
+    value: property,
+  }));
+
+  const update = (updated: VariableQuery) => {
+    const definition =
+      updated.entitySet && updated.property ? `${updated.entitySet.name}/${updated.property.name}` : '';
+    onChange(updated, definition);
+  };
+
+  return (
+    <div>
+      {metadataError && <Alert title="Metadata could not be loaded">{metadataError}</Alert>}
+      <div className="gf-form-inline">
+        <div className="gf-form">
+          <InlineFormLabel width={8} tooltip="Entity set to read the values from">
+            Entity set
+          </InlineFormLabel>
+          <Select
+            value={entitySets.find((o) => o.value?.name === query.entitySet?.name)}
+            placeholder="(Entity set)"
+            onChange={(option) => update({ entitySet: option.value, property: undefined })}
+            options={entitySets}
+            isSearchable={true}
+          />
+          <InlineFormLabel width={8} tooltip="Property whose distinct values are the variable values">
+            Property
+          </InlineFormLabel>
+          <Select
+            value={properties.find((o) => o.value?.name === query.property?.name)}
+            placeholder="(Property)"
+            onChange={(option) => update({ ...query, property: option.value })}
+            options={properties}
+            isSearchable={true}
+          />
+        </div>
+      </div>
+    </div>
+  );
+};
@@ -2,8 +2,10 @@ import { DataSourcePlugin } from '@grafana/data';
 import { ODataSource } from './DataSource';
 import { ConfigEditor } from './components/ConfigEditor';
 import { QueryEditor } from './components/QueryEditor';
+import { VariableQueryEditor } from './components/VariableQueryEditor';
 import { ODataQuery, ODataOptions } from './types';
 
 export const plugin = new DataSourcePlugin<ODataSource, ODataQuery, ODataOptions>(ODataSource)
   .setConfigEditor(ConfigEditor)
-  .setQueryEditor(QueryEditor);
+  .setQueryEditor(QueryEditor)
+  .setVariableQueryEditor(VariableQueryEditor);
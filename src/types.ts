@@ -6,12 +6,89 @@ export interface ODataQuery extends DataQuery {
   timeProperty?: Property | null;
   properties?: Property[];
   filterConditions?: FilterCondition[];
+  filter?: FilterNode;
+  // Free-text search expression, e.g. 'blue OR "dark green"'
+  search?: string;
+  aggregation?: Aggregation;
+  annotation?: Annotation;
+  count?: CountOptions;
+  // Time series are ordered by the time property if no order is given
+  orderBy?: OrderBy[];
+  // Limits the number of entities or aggregated rows, 0 for no limit
+  top?: number;
+  // Name of a selected collection property whose elements each get a row of their own
+  explode?: string;
+  // Returns the numeric values of enum properties instead of the member names
+  numericEnums?: boolean;
+  // Current values of the dashboard variables, resolved by the backend
+  variables?: Record<string, string[]>;
 }
 
-export const FilterOperators: string[] = ['eq', 'ne', 'gt', 'ge', 'lt', 'le'];
+// Query of a template variable, which lists the distinct values of a property
+export interface VariableQuery {
+  entitySet?: EntitySet;
+  property?: Property;
+}
+
+export enum QueryType {
+  Entities = '',
+  Aggregation = 'aggregation',
+  Annotations = 'annotations',
+  Count = 'count',
+}
+
+export interface CountOptions {
+  // Counts per time interval like Aggregation.timeBucket, empty for a single count
+  timeBucket?: string;
+}
+
+export interface OrderBy {
+  property: Property;
+  direction?: 'asc' | 'desc';
+}
+
+// Maps properties to annotation fields, the time property of the query is the start time
+export interface Annotation {
+  // Turns the annotations into regions
+  timeEndProperty?: Property;
+  titleProperty?: Property;
+  textProperty?: Property;
+  tagProperties?: Property[];
+}
+
+export const FilterOperators: string[] = [
+  'eq', 'ne', 'gt', 'ge', 'lt', 'le', 'contains', 'startswith', 'endswith', 'in', 'has', 'isnull', 'isnotnull',
+];
+
+// Operators that compare with null and take no value, 'eq' with the value null compares strings with 'null'
+export const NullFilterOperators: string[] = ['isnull', 'isnotnull'];
+
+export const AggregationMethods: string[] = ['sum', 'average', 'min', 'max', 'countdistinct', 'count'];
+
+export interface Aggregation {
+  groupBy?: Property[];
+  aggregates?: Aggregate[];
+  // 'auto' for the query interval or a duration like '15m', empty to aggregate over the whole time range
+  timeBucket?: string;
+}
+
+export interface Aggregate {
+  property?: Property;
+  method: string;
+  alias?: string;
+}
 
 export interface ODataOptions extends DataSourceJsonData {
   urlSpaceEncoding: string;
+  maxPages?: number;
+  maxRows?: number;
+  // Megabytes of response bodies read per query
+  maxResponseSize?: number;
+  maxConcurrentQueries?: number;
+  maxConcurrentRequests?: number;
+  batchRequests?: boolean;
+  // Seconds the metadata is reused without revalidation, negative to revalidate on every load
+  metadataCacheTtl?: number;
 }
 
 export enum URLSpaceEncoding {
@@ -20,28 +97,119 @@ export enum URLSpaceEncoding {
 }
 
 export interface Metadata {
+  version: string;
   entityTypes: { [name: string]: EntityType };
+  complexTypes?: { [name: string]: ComplexType };
+  enumTypes?: { [name: string]: EnumType };
   entitySets: { [name: string]: EntitySet };
 }
 
+export interface EnumType {
+  name: string;
+  qualifiedName: string;
+  underlyingType: string;
+  // Members of flags enums can be combined, e.g. 'Red,Blue'
+  isFlags: boolean;
+  members: EnumMember[];
+}
+
+export interface EnumMember {
+  name: string;
+  value: number;
+}
+
+export interface ComplexType {
+  name: string;
+  qualifiedName: string;
+  properties: Property[];
+}
+
 export interface EntityType {
   name: string;
   qualifiedName: string;
+  baseType?: string;
+  abstract?: boolean;
+  key?: string[];
+  // Declared and inherited properties, the properties of the base types first
   properties: Property[];
+  navigationProperties?: NavigationProperty[];
+}
+
+export interface NavigationProperty {
+  name: string;
+  entityType: string;
+  collection: boolean;
 }
 
 export interface EntitySet {
+  // Derived types of an entity set are named by type-cast segment, e.g. 'Orders/NS.SpecialOrder'
   name: string;
   entityType: string;
 }
 
 export interface Property {
+  // Properties of related entities and of complex types are given as path, e.g. 'Customer/Name' or 'Address/City'
   name: string;
   type: string;
 }
 
+// Property types the backend reads as time, Edm.DateTime and Edm.Date are used by V2 services
+export const TimePropertyTypes: string[] = ['Edm.DateTimeOffset', 'Edm.DateTime', 'Edm.Date'];
+
+// Complex types nested deeper are not offered, which also stops recursive complex types
+const maxComplexTypeDepth = 5;
+
+// Flattens properties of complex types into their sub-properties, e.g. 'Address' into 'Address/City'
+export function flattenProperties(metadata: Metadata, properties: Property[], prefix = '', depth = 0): Property[] {
+  return properties.flatMap((property) => {
+    const complexType = metadata.complexTypes?.[property.type];
+    if (!complexType) {
+      return [{ name: prefix + property.name, type: property.type }];
+    }
+    if (depth >= maxComplexTypeDepth) {
+      return [];
+    }
+    return flattenProperties(metadata, complexType.properties, `${prefix}${property.name}/`, depth + 1);
+  });
+}
+
+// Single-valued navigation properties are followed this deep, e.g. 'Customer/Country/Name'
+const maxNavigationDepth = 2;
+
+// Lists the properties of an entity type and of its related entities, e.g. 'Customer/Name'. Collection-valued
+// navigation properties are not followed, their properties have no single value per entity.
+export function entityTypeProperties(metadata: Metadata, entityType: string, prefix = '', depth = 0): Property[] {
+  const type = metadata.entityTypes[entityType];
+  if (!type) {
+    return [];
+  }
+  const properties = flattenProperties(metadata, type.properties, prefix);
+  if (depth >= maxNavigationDepth) {
+    return properties;
+  }
+  return properties.concat(
+    (type.navigationProperties ?? [])
+      .filter((navigationProperty) => !navigationProperty.collection)
+      .flatMap((navigationProperty) =>
+        entityTypeProperties(metadata, navigationProperty.entityType, `${prefix}${navigationProperty.name}/`, depth + 1)
+      )
+  );
+}
+
 export interface FilterCondition {
   property: Property;
   operator: string;
   value: string;
+  // Values of list operators like 'in', otherwise value is read as comma separated list
+  values?: string[];
+  // Compares the lowercased values of string properties
+  caseInsensitive?: boolean;
+}
+
+// Node of a filter tree: either a single condition or a group combining its children with 'and' or 'or'
+export interface FilterNode {
+  operator?: 'and' | 'or';
+  not?: boolean;
+  children?: FilterNode[];
+  condition?: FilterCondition;
 }